@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ActionState is the outcome of a mutating command on a repo or branch
+type ActionState string
+
+const (
+	ActionDone    ActionState = "done"
+	ActionPlanned ActionState = "planned"
+	ActionSkipped ActionState = "skipped"
+	ActionRefused ActionState = "refused"
+	ActionFailed  ActionState = "failed"
+)
+
+type ActionResult struct {
+	Dir    string
+	Branch string
+	State  ActionState
+	Detail string
+}
+
+func ActionResultsSort(results []ActionResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Dir != results[j].Dir {
+			return results[i].Dir < results[j].Dir
+		}
+		return results[i].Branch < results[j].Branch
+	})
+}
+
+// ActionResultsPrint prints one line per result. Branch results are grouped
+// under their repo.
+func ActionResultsPrint(results []ActionResult) {
+	ActionResultsSort(results)
+	dir := ""
+	for _, result := range results {
+		var marker, clr string
+		switch result.State {
+		case ActionDone:
+			marker, clr = " \u2714  ", clrGreen
+		case ActionPlanned:
+			marker, clr = " ~  ", clrGreen
+		case ActionSkipped:
+			marker, clr = " -  ", clrReset
+		case ActionRefused:
+			marker, clr = " !  ", clrYellow
+		default:
+			marker, clr = " x  ", clrRed
+		}
+		if result.Branch == "" {
+			fmt.Printf(clr + marker + clrReset + fmt.Sprintf("%-40s", result.Dir) + " " + clr + result.Detail + clrReset + NL)
+			continue
+		}
+		if result.Dir != dir {
+			dir = result.Dir
+			fmt.Printf(fmt.Sprintf("%-44s", dir) + NL)
+		}
+		fmt.Printf("  " + clr + marker + clrReset + fmt.Sprintf("%-38s", result.Branch) + " " + clr + result.Detail + clrReset + NL)
+	}
+}
+
+// ActionSummaryPrint prints the repos per state. A repo counts in its worst
+// state. done labels the repos where the action happened, eg `pushed`.
+func ActionSummaryPrint(results []ActionResult, done string) {
+	rank := map[ActionState]int{ActionSkipped: 0, ActionPlanned: 1, ActionDone: 2, ActionRefused: 3, ActionFailed: 4}
+	worst := make(map[string]ActionState)
+	for _, result := range results {
+		if state, ok := worst[result.Dir]; !ok || rank[result.State] > rank[state] {
+			worst[result.Dir] = result.State
+		}
+	}
+
+	dirs := make(map[ActionState][]string)
+	for dir, state := range worst {
+		dirs[state] = append(dirs[state], dir)
+	}
+	fmt.Print(NL)
+	for _, state := range []ActionState{ActionDone, ActionPlanned, ActionSkipped, ActionRefused, ActionFailed} {
+		if len(dirs[state]) == 0 {
+			continue
+		}
+		sort.Strings(dirs[state])
+		label := string(state)
+		if state == ActionDone {
+			label = done
+		}
+		fmt.Printf(fmt.Sprintf("%-8s %3d", label, len(dirs[state])) + "  " + strings.Join(dirs[state], " ") + NL)
+	}
+}
+
+// ActionFailures counts results that were refused or failed
+func ActionFailures(results []ActionResult) (n int) {
+	for _, result := range results {
+		if result.State == ActionRefused || result.State == ActionFailed {
+			n++
+		}
+	}
+	return n
+}
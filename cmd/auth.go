@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	keyring "github.com/99designs/keyring"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	giturls "github.com/whilp/git-urls"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AuthResolver picks the auth for each remote url from its scheme. ssh
+// remotes use the keys in ssh-agent, then the IdentityFile entries of
+// ~/.ssh/config for the host, and only when there are none, the -k key.
+// ssh host keys are verified by HostKeys. https remotes use a token, see
+// httpsAuthGet. Auth is resolved once per user and host and shared by all
+// repos. A nil resolver gives no auth.
+type AuthResolver struct {
+	v         *viper.Viper
+	sshConfig *SSHConfig
+	agentSock string
+	// hosts whose https certificates are not verified
+	insecureHosts []string
+	// verifies ssh host keys, go-git reads known_hosts itself when nil
+	hostKeys *HostKeys
+
+	mu       sync.Mutex
+	cache    map[string]authResult
+	agent    agent.Agent
+	agentErr error
+	explicit *gitssh.PublicKeys
+	explErr  error
+	ring     keyring.Keyring
+}
+
+type authResult struct {
+	auth transport.AuthMethod
+	err  error
+}
+
+// AuthResolverNew reads SSH_AUTH_SOCK and ~/.ssh/config. The ssh config is
+// also given to go-git, which uses it for HostName and Port.
+func AuthResolverNew(v *viper.Viper) *AuthResolver {
+	sshConfig := &SSHConfig{}
+	if home, err := os.UserHomeDir(); err == nil {
+		sshConfig, err = SSHConfigLoad(filepath.Join(home, ".ssh", "config"))
+		if err != nil {
+			log.Warnf("ignoring ~/.ssh/config: %v", err)
+			sshConfig = &SSHConfig{}
+		}
+	}
+	gitssh.DefaultSSHConfig = sshConfig
+	a := authResolverNew(v, sshConfig, os.Getenv("SSH_AUTH_SOCK"))
+	a.insecureHosts = InsecureSkipTLSGet(v)
+	a.hostKeys = HostKeysNew(v)
+	return a
+}
+
+func authResolverNew(v *viper.Viper, sshConfig *SSHConfig, agentSock string) *AuthResolver {
+	return &AuthResolver{v: v, sshConfig: sshConfig, agentSock: agentSock, cache: make(map[string]authResult)}
+}
+
+// Get returns the auth for url, or nil for urls that need none
+func (a *AuthResolver) Get(url string) (transport.AuthMethod, error) {
+	if a == nil {
+		return nil, nil
+	}
+	u, err := giturls.Parse(url)
+	if err != nil {
+		return nil, nil
+	}
+	host := u.Hostname()
+	user := u.User.Username()
+
+	var key string
+	var get func() (transport.AuthMethod, error)
+	switch u.Scheme {
+	case "ssh":
+		if user == "" {
+			user = a.sshConfig.Get(host, "User")
+		}
+		if user == "" {
+			user = "git"
+		}
+		key = user + "@" + host
+		get = func() (transport.AuthMethod, error) { return a.sshAuthGet(host, user) }
+	case "http":
+		// tokens are never sent in cleartext
+		log.Debugf("not sending credentials to %s over plain http", u.Host)
+		return nil, nil
+	case "https":
+		// go-git uses a password in the url itself
+		if _, ok := u.User.Password(); ok {
+			return nil, nil
+		}
+		key = u.Scheme + "://" + user + "@" + u.Host
+		get = func() (transport.AuthMethod, error) { return a.httpsAuthGet(u.Host, user, u.Path) }
+	default:
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cached, ok := a.cache[key]; ok {
+		return cached.auth, cached.err
+	}
+	auth, err := get()
+	if err != nil {
+		err = fmt.Errorf("could not get %s auth for %s: %v", u.Scheme, key, err)
+	}
+	a.cache[key] = authResult{auth: auth, err: err}
+	return auth, err
+}
+
+// TimeoutCtx returns a context for a fetch that times out after timeout,
+// not counting the time spent asking about host keys
+func (a *AuthResolver) TimeoutCtx(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if a == nil {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return a.hostKeys.TimeoutCtx(ctx, timeout)
+}
+
+// InsecureSkipTLS is true when the certificate of the https host of url must
+// not be verified
+func (a *AuthResolver) InsecureSkipTLS(url string) bool {
+	if a == nil {
+		return false
+	}
+	u, err := giturls.Parse(url)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	for _, host := range a.insecureHosts {
+		if strings.EqualFold(host, u.Hostname()) || strings.EqualFold(host, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteURLGet returns the first url of a remote of r
+func RemoteURLGet(r *git.Repository, remote string) (string, error) {
+	rem, err := r.Remote(remote)
+	if err != nil {
+		return "", fmt.Errorf("could not get remote %s: %v", remote, err)
+	}
+	if len(rem.Config().URLs) == 0 {
+		return "", nil
+	}
+	return rem.Config().URLs[0], nil
+}
+
+func (a *AuthResolver) sshAuthGet(host string, user string) (transport.AuthMethod, error) {
+	// keys in the agent first
+	signers, err := a.agentSignersGet()
+	if err != nil {
+		log.Debugf("not using ssh-agent: %v", err)
+	}
+	fromAgent := len(signers)
+
+	// then the identity files for the host
+	for _, file := range a.sshConfig.IdentityFilesGet(host, user) {
+		signer, err := SignerLoad(file, "")
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if fromAgent > 0 {
+				log.Debugf("skipping %s, it needs a password and ssh-agent has keys", file)
+				continue
+			}
+			var password string
+			password, err = PrvKPasswordGet(a.v, file)
+			if err == nil {
+				signer, err = SignerLoad(file, password)
+			}
+		}
+		if os.IsNotExist(err) {
+			log.Debugf("skipping missing IdentityFile %s", file)
+			continue
+		}
+		if err != nil {
+			log.Warnf("skipping IdentityFile %s: %v", file, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	var helper gitssh.HostKeyCallbackHelper
+	if a.hostKeys != nil {
+		helper.HostKeyCallback = a.hostKeys.Callback
+	}
+	if len(signers) > 0 {
+		return &gitssh.PublicKeysCallback{
+			User:                  user,
+			Callback:              func() ([]ssh.Signer, error) { return signers, nil },
+			HostKeyCallbackHelper: helper,
+		}, nil
+	}
+
+	// and only then the explicit key, loaded once for every host
+	if a.explicit == nil && a.explErr == nil {
+		a.explicit, a.explErr = PubKsGet(a.v)
+	}
+	if a.explErr != nil {
+		return nil, fmt.Errorf("no keys in ssh-agent or IdentityFile in ~/.ssh/config, and %v", a.explErr)
+	}
+	return &gitssh.PublicKeys{User: user, Signer: a.explicit.Signer, HostKeyCallbackHelper: helper}, nil
+}
+
+// agentSignersGet connects to the agent once and returns its keys
+func (a *AuthResolver) agentSignersGet() ([]ssh.Signer, error) {
+	if a.agent == nil && a.agentErr == nil {
+		if a.agentSock == "" {
+			a.agentErr = fmt.Errorf("SSH_AUTH_SOCK is not set")
+		} else if conn, err := net.Dial("unix", a.agentSock); err != nil {
+			a.agentErr = fmt.Errorf("could not connect to ssh-agent: %v", err)
+		} else {
+			a.agent = agent.NewClient(conn)
+		}
+	}
+	if a.agentErr != nil {
+		return nil, a.agentErr
+	}
+	return a.agent.Signers()
+}
+
+// SignerLoad reads a private key file
+func SignerLoad(file string, password string) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return ssh.ParsePrivateKey(data)
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(data, []byte(password))
+}
+
+// SSHConfig reads values for hosts from an ssh config file. The zero value
+// has no hosts.
+type SSHConfig struct {
+	cfg *ssh_config.Config
+}
+
+func SSHConfigLoad(path string) (*SSHConfig, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &SSHConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := ssh_config.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHConfig{cfg: cfg}, nil
+}
+
+// Get returns the first value of key for host. It satisfies the config
+// interface of go-git, which only reads Port when HostName is set, so
+// HostName defaults to the host when the host has a Port.
+func (c *SSHConfig) Get(host string, key string) string {
+	values := c.getAll(host, key)
+	if len(values) > 0 {
+		return values[0]
+	}
+	if strings.EqualFold(key, "HostName") && c.Get(host, "Port") != "" {
+		return host
+	}
+	return ""
+}
+
+// IdentityFilesGet returns the IdentityFile paths for host with ~ and the
+// %d, %h, %r and %% tokens expanded
+func (c *SSHConfig) IdentityFilesGet(host string, user string) []string {
+	home, _ := os.UserHomeDir()
+	hostName := c.Get(host, "HostName")
+	if hostName == "" {
+		hostName = host
+	}
+	replacer := strings.NewReplacer("%d", home, "%h", hostName, "%r", user, "%%", "%")
+
+	files := make([]string, 0)
+	for _, file := range c.getAll(host, "IdentityFile") {
+		if strings.HasPrefix(file, "~/") {
+			file = filepath.Join(home, file[2:])
+		}
+		files = append(files, replacer.Replace(file))
+	}
+	return files
+}
+
+func (c *SSHConfig) getAll(host string, key string) (values []string) {
+	if c == nil || c.cfg == nil {
+		return nil
+	}
+	// ssh_config panics on Match directives, which are not supported
+	defer func() {
+		if r := recover(); r != nil {
+			log.Debugf("could not read %s for %s from ssh config: %v", key, host, r)
+			values = nil
+		}
+	}()
+	values, _ = c.cfg.GetAll(host, key)
+	return values
+}
+
+// https tokens come from, in order, the GITALL_TOKEN_<HOST> env var, the
+// keyring under TokenRingKey, and `git credential fill`. GITALL_TOKEN is only
+// for github.com, so a token never reaches another host. Remotes without a
+// token are fetched anonymously.
+
+const TOKEN_ENV = "GITALL_TOKEN"
+
+// TokenEnvGet returns the env var with the token for host, eg
+// GITALL_TOKEN_GITHUB_COM for github.com
+func TokenEnvGet(host string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, host)
+	return TOKEN_ENV + "_" + name
+}
+
+// TokenRingKey is the keyring key of the token for host
+func TokenRingKey(host string) string {
+	return "token:" + host
+}
+
+// TokenEnvsGet returns the env vars that may hold the token for host
+func TokenEnvsGet(host string) []string {
+	if host == GITHUB_HOST {
+		return []string{TokenEnvGet(host), TOKEN_ENV}
+	}
+	return []string{TokenEnvGet(host)}
+}
+
+// TokenLookup returns the token for host from its env vars or the ring entry
+// of that exact host, and where it was found. ring may be nil.
+func TokenLookup(ring keyring.Keyring, host string) (token string, source string) {
+	for _, env := range TokenEnvsGet(host) {
+		if token := os.Getenv(env); token != "" {
+			return token, env
+		}
+	}
+	if ring == nil {
+		return "", ""
+	}
+	item, err := ring.Get(TokenRingKey(host))
+	if err == nil && len(item.Data) > 0 {
+		return string(item.Data), "keyring"
+	}
+	if err != nil && err != keyring.ErrKeyNotFound {
+		log.Debugf("could not query keyring for the token of %s: %v", host, err)
+	}
+	return "", ""
+}
+
+func (a *AuthResolver) httpsAuthGet(host string, user string, path string) (transport.AuthMethod, error) {
+	if user == "" {
+		user = "git"
+	}
+	basic := func(token string) transport.AuthMethod {
+		return &githttp.BasicAuth{Username: user, Password: token}
+	}
+
+	if a.ring == nil {
+		ring, err := KeyringOpen()
+		if err != nil {
+			log.Debugf("not using the keyring for tokens: %v", err)
+		}
+		a.ring = ring
+	}
+	if token, source := TokenLookup(a.ring, host); token != "" {
+		log.Debugf("using the token in %s for %s", source, host)
+		return basic(token), nil
+	}
+
+	helperUser, token, err := CredentialFill("https", host, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		log.Debugf("no token from git credential for %s: %v", host, err)
+	}
+	if token != "" {
+		if helperUser != "" {
+			user = helperUser
+		}
+		return basic(token), nil
+	}
+	log.Debugf("no token for %s, fetching anonymously", host)
+	return nil, nil
+}
+
+// CredentialFill asks the git credential helpers for the username and
+// password of a url. git never prompts.
+func CredentialFill(scheme string, host string, path string) (user string, password string, err error) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	cmd.Stdin = strings.NewReader("protocol=" + scheme + "\nhost=" + host + "\npath=" + path + "\n\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "username":
+			user = value
+		case "password":
+			password = value
+		}
+	}
+	return user, password, nil
+}
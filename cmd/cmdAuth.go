@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	keyring "github.com/99designs/keyring"
+	"github.com/google/go-github/v49/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// the GitHub token is kept in the keyring under TokenRingKey(GITHUB_HOST), so
+// it also authenticates https remotes on github.com
+
+const GITHUB_HOST = "github.com"
+const GITHUB_URL = "https://github.com"
+
+// keyring keys of the username and password that older versions stored
+var githubLegacyRingKeys = []string{"ghuser", "ghpass"}
+
+func CMDAuthInit() {
+	// CLI Command with subcommands
+	c := &cobra.Command{
+		Use:   "auth",
+		Short: "Log in to github.com for the GitHub API and https remotes.",
+	}
+	c.AddCommand(CMDAuthLoginInit())
+	c.AddCommand(CMDAuthStatusInit())
+	c.AddCommand(CMDAuthLogoutInit())
+	MAIN.AddCommand(c)
+}
+
+func CMDAuthLoginInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "login",
+		Short: "Log in with the OAuth device flow or a personal access token.",
+		// Long:  ``,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDAuthLogin(v)
+		},
+	}
+
+	WithTokenFlag(c, v)
+	ClientIDFlag(c, v)
+	ScopesFlag(c, v)
+	return c
+}
+
+func CMDAuthStatusInit() *cobra.Command {
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "status",
+		Short: "Show where the github.com token comes from and who it belongs to.",
+		// Long:  ``,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDAuthStatus()
+		},
+	}
+	return c
+}
+
+func CMDAuthLogoutInit() *cobra.Command {
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "logout",
+		Short: "Remove the stored github.com credentials from the keyring.",
+		// Long:  ``,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDAuthLogout()
+		},
+	}
+	return c
+}
+
+const WITH_TOKEN = "with-token"
+
+func WithTokenFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(WITH_TOKEN, false, "read a personal access token from stdin instead of using the device flow")
+	v.BindPFlag(WITH_TOKEN, c.PersistentFlags().Lookup(WITH_TOKEN))
+}
+
+const CLIENT_ID = "client-id"
+const CLIENT_ID_ENV = "GITALL_GITHUB_CLIENT_ID"
+
+func ClientIDFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(CLIENT_ID, "", "client id of the GitHub OAuth app for the device flow (default $"+CLIENT_ID_ENV+")")
+	v.BindPFlag(CLIENT_ID, c.PersistentFlags().Lookup(CLIENT_ID))
+}
+
+func ClientIDGet(v *viper.Viper) string {
+	if clientID := v.GetString(CLIENT_ID); clientID != "" {
+		return clientID
+	}
+	return os.Getenv(CLIENT_ID_ENV)
+}
+
+const SCOPES = "scopes"
+
+func ScopesFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(SCOPES, []string{"repo"}, "scopes to request in the device flow")
+	v.BindPFlag(SCOPES, c.PersistentFlags().Lookup(SCOPES))
+}
+
+func CMDAuthLogin(v *viper.Viper) {
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	var token string
+	if v.GetBool(WITH_TOKEN) {
+		var err error
+		token, err = TokenRead(os.Stdin)
+		if err != nil {
+			log.Fatalf("could not read token: %v", err)
+		}
+	} else {
+		if NonInteractiveGet() {
+			log.Fatal(ErrNonInteractive("a device flow login", "pipe a token to --with-token"))
+		}
+		clientID := ClientIDGet(v)
+		if clientID == "" {
+			log.Fatalf("the device flow needs the client id of a GitHub OAuth app. give --client-id or set %s, or log in with --with-token", CLIENT_ID_ENV)
+		}
+		flow := DeviceFlow{BaseURL: GITHUB_URL, ClientID: clientID, Scopes: v.GetStringSlice(SCOPES), Client: http.DefaultClient}
+		var err error
+		token, err = flow.Run(ctx, os.Stderr)
+		if err != nil {
+			log.Fatalf("could not log in: %v", err)
+		}
+	}
+
+	// check the token before keeping it
+	login, scopes, err := GithubWhoamiGet(ctx, GithubClientNew(token))
+	if err != nil {
+		log.Fatalf("could not verify token: %v", err)
+	}
+	err = KeyringGet().Set(keyring.Item{Key: TokenRingKey(GITHUB_HOST), Data: []byte(token), Label: "gitall " + GITHUB_HOST + " token"})
+	if err != nil {
+		log.Fatalf("could not save token in keyring: %v", err)
+	}
+	fmt.Printf(clrGreen+"logged in to %s as %s"+clrReset+" (scopes: %s)"+NL, GITHUB_HOST, login, ScopesText(scopes))
+}
+
+// TokenRead reads a token from r, prompting when r is a terminal
+func TokenRead(r *os.File) (string, error) {
+	if term.IsTerminal(int(r.Fd())) {
+		if NonInteractiveGet() {
+			return "", ErrNonInteractive("a token", "pipe it to --with-token")
+		}
+		return PromptSecret("Paste a personal access token:"), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("no token on stdin")
+	}
+	return token, nil
+}
+
+func CMDAuthStatus() {
+	ring, err := KeyringOpen()
+	if err != nil {
+		log.Warnf("could not access keyring: %v", err)
+	}
+	token, source := TokenLookup(ring, GITHUB_HOST)
+	if token == "" {
+		fmt.Printf(clrYellow+"not logged in to %s"+clrReset+". run `gitall auth login`"+NL, GITHUB_HOST)
+		os.Exit(1)
+	}
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+	login, scopes, err := GithubWhoamiGet(ctx, GithubClientNew(token))
+	if err != nil {
+		fmt.Printf(clrRed+"the %s token from %s does not work: %v"+clrReset+NL, GITHUB_HOST, source, err)
+		os.Exit(1)
+	}
+	fmt.Printf(clrGreen+"logged in to %s as %s"+clrReset+" with the token from %s (scopes: %s)"+NL, GITHUB_HOST, login, source, ScopesText(scopes))
+}
+
+func CMDAuthLogout() {
+	removed, err := AuthLogout(KeyringGet(), GITHUB_HOST)
+	if err != nil {
+		log.Fatalf("could not log out: %v", err)
+	}
+	if len(removed) == 0 {
+		fmt.Printf("no %s credentials in the keyring"+NL, GITHUB_HOST)
+	} else {
+		fmt.Printf("removed %s from the keyring"+NL, strings.Join(removed, ", "))
+	}
+	for _, env := range TokenEnvsGet(GITHUB_HOST) {
+		if os.Getenv(env) != "" {
+			log.Warnf("%s is still set and is used before the keyring", env)
+		}
+	}
+}
+
+// AuthLogout removes the token of host and the legacy github.com username
+// and password from ring. It returns the keys that were removed.
+func AuthLogout(ring keyring.Keyring, host string) ([]string, error) {
+	keys := []string{TokenRingKey(host)}
+	if host == GITHUB_HOST {
+		keys = append(keys, githubLegacyRingKeys...)
+	}
+	removed := make([]string, 0)
+	for _, key := range keys {
+		// not every backend reports missing keys on Remove
+		if _, err := ring.Get(key); err == keyring.ErrKeyNotFound {
+			continue
+		}
+		if err := ring.Remove(key); err != nil {
+			return removed, fmt.Errorf("could not remove %s: %v", key, err)
+		}
+		removed = append(removed, key)
+	}
+	return removed, nil
+}
+
+func ScopesText(scopes string) string {
+	if scopes == "" {
+		return "none listed"
+	}
+	return scopes
+}
+
+// TokenTransport sends a token with every request
+type TokenTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.Token)
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func GithubClientNew(token string) *github.Client {
+	return github.NewClient(&http.Client{Transport: &TokenTransport{Token: token}})
+}
+
+// GithubWhoamiGet returns the login of the token owner and the scopes of the
+// token
+func GithubWhoamiGet(ctx context.Context, client *github.Client) (login string, scopes string, err error) {
+	user, resp, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", "", err
+	}
+	return user.GetLogin(), resp.Header.Get("X-OAuth-Scopes"), nil
+}
+
+// DeviceFlow logs in with the OAuth device flow, see
+// https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps#device-flow
+type DeviceFlow struct {
+	BaseURL  string
+	ClientID string
+	Scopes   []string
+	Client   *http.Client
+}
+
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type deviceToken struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Interval         int    `json:"interval"`
+}
+
+// Run asks for a code, tells the user where to enter it and waits for the
+// token
+func (f *DeviceFlow) Run(ctx context.Context, w io.Writer) (string, error) {
+	code, err := f.CodeGet(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "Enter the code "+clrYellow+"%s"+clrReset+" at %s"+NL, code.UserCode, code.VerificationURI)
+	return f.TokenPoll(ctx, code)
+}
+
+func (f *DeviceFlow) CodeGet(ctx context.Context) (*DeviceCode, error) {
+	code := &DeviceCode{}
+	form := url.Values{"client_id": {f.ClientID}, "scope": {strings.Join(f.Scopes, " ")}}
+	if err := f.post(ctx, "/login/device/code", form, code); err != nil {
+		return nil, fmt.Errorf("could not get device code: %v", err)
+	}
+	if code.DeviceCode == "" {
+		return nil, fmt.Errorf("could not get device code: empty response")
+	}
+	return code, nil
+}
+
+// deviceFlowStep is the poll interval when the server gives none and the
+// backoff after each slow_down, per RFC 8628
+var deviceFlowStep = 5 * time.Second
+
+// TokenPoll polls for the token at the interval of the code until the user
+// enters it, denies it or it expires
+func (f *DeviceFlow) TokenPoll(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = deviceFlowStep
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	form := url.Values{
+		"client_id":   {f.ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for {
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return "", fmt.Errorf("the code expired, run login again")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token := deviceToken{}
+		if err := f.post(ctx, "/login/oauth/access_token", form, &token); err != nil {
+			return "", fmt.Errorf("could not get token: %v", err)
+		}
+		switch token.Error {
+		case "":
+			if token.AccessToken == "" {
+				return "", fmt.Errorf("could not get token: empty response")
+			}
+			return token.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += deviceFlowStep
+			if server := time.Duration(token.Interval) * time.Second; server > interval {
+				interval = server
+			}
+		case "expired_token":
+			return "", fmt.Errorf("the code expired, run login again")
+		case "access_denied":
+			return "", fmt.Errorf("the login was denied")
+		default:
+			return "", fmt.Errorf("could not get token: %s %s", token.Error, token.ErrorDescription)
+		}
+	}
+}
+
+func (f *DeviceFlow) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(f.BaseURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
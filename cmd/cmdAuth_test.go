@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	keyring "github.com/99designs/keyring"
+)
+
+// deviceFlowStepSet shortens the poll interval for a test
+func deviceFlowStepSet(t *testing.T, step time.Duration) {
+	t.Helper()
+	old := deviceFlowStep
+	deviceFlowStep = step
+	t.Cleanup(func() { deviceFlowStep = old })
+}
+
+func TestDeviceFlowPollsUntilAuthorized(t *testing.T) {
+	deviceFlowStepSet(t, time.Millisecond)
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "client" {
+			t.Errorf("unexpected client id %q", r.Form.Get("client_id"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/device/code":
+			if r.Form.Get("scope") != "repo read:org" {
+				t.Errorf("unexpected scope %q", r.Form.Get("scope"))
+			}
+			fmt.Fprint(w, `{"device_code":"dev","user_code":"ABCD-1234","verification_uri":"https://github.com/login/device","expires_in":900,"interval":0}`)
+		case "/login/oauth/access_token":
+			if r.Form.Get("device_code") != "dev" {
+				t.Errorf("unexpected device code %q", r.Form.Get("device_code"))
+			}
+			polls++
+			if polls < 3 {
+				fmt.Fprint(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"gho_token","token_type":"bearer","scope":"repo"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	flow := DeviceFlow{BaseURL: server.URL, ClientID: "client", Scopes: []string{"repo", "read:org"}, Client: server.Client()}
+	token, err := flow.Run(context.Background(), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "gho_token" || polls != 3 {
+		t.Fatalf("expected the token after 3 polls, got %q after %d", token, polls)
+	}
+	if !strings.Contains(out.String(), "ABCD-1234") || !strings.Contains(out.String(), "https://github.com/login/device") {
+		t.Fatalf("expected the user code and url, got %q", out.String())
+	}
+}
+
+func TestDeviceFlowSlowsDown(t *testing.T) {
+	deviceFlowStepSet(t, 20*time.Millisecond)
+	var polls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls = append(polls, time.Now())
+		if len(polls) < 3 {
+			fmt.Fprint(w, `{"error":"slow_down"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"gho_token"}`)
+	}))
+	defer server.Close()
+
+	flow := DeviceFlow{BaseURL: server.URL, ClientID: "client", Client: server.Client()}
+	start := time.Now()
+	if _, err := flow.TokenPoll(context.Background(), &DeviceCode{DeviceCode: "dev", ExpiresIn: 900}); err != nil {
+		t.Fatal(err)
+	}
+	// 20ms by default, then 40ms and 60ms after each slow_down
+	if len(polls) != 3 || polls[0].Sub(start) < 20*time.Millisecond || polls[2].Sub(polls[1]) < 60*time.Millisecond {
+		t.Fatalf("expected the interval to grow on slow_down, polled at %v", polls)
+	}
+}
+
+func TestDeviceFlowReportsDenial(t *testing.T) {
+	deviceFlowStepSet(t, time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":"access_denied"}`)
+	}))
+	defer server.Close()
+
+	flow := DeviceFlow{BaseURL: server.URL, ClientID: "client", Client: server.Client()}
+	_, err := flow.TokenPoll(context.Background(), &DeviceCode{DeviceCode: "dev", ExpiresIn: 900})
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("expected a denial, got %v", err)
+	}
+}
+
+func TestGithubWhoamiGetSendsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token ghp_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"Bad credentials"}`)
+			return
+		}
+		w.Header().Set("X-OAuth-Scopes", "repo, workflow")
+		fmt.Fprint(w, `{"login":"octocat"}`)
+	}))
+	defer server.Close()
+
+	client := GithubClientNew("ghp_secret")
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	login, scopes, err := GithubWhoamiGet(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "octocat" || scopes != "repo, workflow" {
+		t.Fatalf("unexpected login %q and scopes %q", login, scopes)
+	}
+
+	client = GithubClientNew("wrong")
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	if _, _, err := GithubWhoamiGet(context.Background(), client); err == nil {
+		t.Fatalf("expected a bad token to fail")
+	}
+}
+
+func TestAuthLogoutRemovesTokenAndLegacyCredentials(t *testing.T) {
+	t.Setenv(TOKEN_ENV, "")
+	t.Setenv(TokenEnvGet(GITHUB_HOST), "")
+	t.Setenv(TokenEnvGet("git.example.com"), "")
+	ring := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: TokenRingKey(GITHUB_HOST), Data: []byte("token")},
+		{Key: "ghpass", Data: []byte("password")},
+		{Key: TokenRingKey("git.example.com"), Data: []byte("other")},
+	})
+
+	removed, err := AuthLogout(ring, GITHUB_HOST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(removed, ",") != TokenRingKey(GITHUB_HOST)+",ghpass" {
+		t.Fatalf("unexpected removed keys %v", removed)
+	}
+	if token, _ := TokenLookup(ring, GITHUB_HOST); token != "" {
+		t.Fatalf("expected no token after logout")
+	}
+	if token, _ := TokenLookup(ring, "git.example.com"); token != "other" {
+		t.Fatalf("expected the tokens of other hosts to stay")
+	}
+
+	removed, err = AuthLogout(ring, GITHUB_HOST)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("expected nothing to remove, got %v %v", removed, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CMDBranchInit() {
+	// CLI Command with subcommands
+	c := &cobra.Command{
+		Use:   "branch",
+		Short: "Manage the same branch across repos.",
+	}
+	c.AddCommand(CMDBranchCreateInit())
+	MAIN.AddCommand(c)
+}
+
+func CMDBranchCreateInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "create <branch> [dirs...]",
+		Short: "Create and check out a branch in every selected repo, or in none of them.",
+		// Long:  ``,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDBranchCreate(v, args[0], args[1:])
+		},
+	}
+
+	DirsFlags(c, v)
+	FromFlag(c, v)
+	DryRunFlag(c, v)
+	return c
+}
+
+const FROM = "from"
+
+func FromFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(FROM, "", "ref to start the branch at, default HEAD")
+	v.BindPFlag(FROM, c.PersistentFlags().Lookup(FROM))
+}
+
+func CMDBranchCreate(v *viper.Viper, branch string, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	plans := make([]SwitchPlan, 0, len(dirs))
+	for _, dir := range dirs {
+		plans = append(plans, SwitchPlanGet(dir, branch, v.GetString(FROM), true))
+	}
+	SwitchRun(plans, v.GetBool(DRY_RUN), "created")
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CMDCheckoutInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "checkout <branch> [dirs...]",
+		Short: "Switch every selected repo to a branch, or none of them.",
+		// Long:  ``,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDCheckout(v, args[0], args[1:])
+		},
+	}
+
+	DirsFlags(c, v)
+	DryRunFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+func CMDCheckout(v *viper.Viper, branch string, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	plans := make([]SwitchPlan, 0, len(dirs))
+	for _, dir := range dirs {
+		plans = append(plans, SwitchPlanGet(dir, branch, "", false))
+	}
+	SwitchRun(plans, v.GetBool(DRY_RUN), "switched")
+}
+
+// SwitchPlan is a branch switch in one repo, with what it takes to undo it
+type SwitchPlan struct {
+	Dir    string
+	Branch plumbing.ReferenceName
+	Hash   plumbing.Hash
+	// Create the branch at Hash. Upstream is set for branches that track a
+	// remote branch.
+	Create   bool
+	Upstream *Upstream
+	// Prev is the HEAD before the switch, a branch or a detached commit
+	Prev   *plumbing.Reference
+	Skip   bool
+	Detail string
+	Error  string
+}
+
+// SwitchPlanGet checks that dir can switch to branch. With create, branch
+// must not exist and starts at from, or HEAD. Without, branch must exist
+// locally or as exactly one remote branch to track.
+func SwitchPlanGet(dir string, branch string, from string, create bool) SwitchPlan {
+	plan := SwitchPlan{Dir: dir, Branch: plumbing.NewBranchReferenceName(branch), Create: create}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not open repo: %v", err)
+		return plan
+	}
+	if err := OperationCheck(r); err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	plan.Prev, err = r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get HEAD: %v", err)
+		return plan
+	}
+	if plan.Prev.Type() == plumbing.SymbolicReference && plan.Prev.Target() == plan.Branch && !create {
+		plan.Skip = true
+		plan.Detail = "already on " + branch
+		return plan
+	}
+
+	// the worktree must be clean to switch
+	w, err := r.Worktree()
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get worktree: %v", err)
+		return plan
+	}
+	gitStatus, err := w.Status()
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get status: %v", err)
+		return plan
+	}
+	if !gitStatus.IsClean() {
+		plan.Error = "has uncommitted changes"
+		return plan
+	}
+
+	existing, err := r.Reference(plan.Branch, true)
+	if create {
+		if err == nil {
+			plan.Error = "branch " + branch + " already exists"
+			return plan
+		}
+		if from == "" {
+			from = plumbing.HEAD.String()
+		}
+		hash, err := r.ResolveRevision(plumbing.Revision(from))
+		if err != nil {
+			plan.Error = fmt.Sprintf("could not resolve %s: %v", from, err)
+			return plan
+		}
+		plan.Hash = *hash
+		plan.Detail = fmt.Sprintf("created %s from %s", branch, from)
+		return plan
+	}
+	if err == nil {
+		plan.Hash = existing.Hash()
+		plan.Detail = "switched to " + branch
+		return plan
+	}
+
+	// track a remote branch of the same name
+	cfg, err := r.Config()
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get config: %v", err)
+		return plan
+	}
+	var found []Upstream
+	for name := range cfg.Remotes {
+		upstream := Upstream{Remote: name, Merge: plan.Branch}
+		ref, err := r.Reference(upstream.RefName(cfg), true)
+		if err != nil {
+			continue
+		}
+		plan.Hash = ref.Hash()
+		found = append(found, upstream)
+	}
+	switch len(found) {
+	case 0:
+		plan.Error = "no branch " + branch
+	case 1:
+		plan.Create = true
+		plan.Upstream = &found[0]
+		plan.Detail = "switched to " + branch + " tracking " + found[0].String()
+	default:
+		remotes := make([]string, 0, len(found))
+		for _, upstream := range found {
+			remotes = append(remotes, upstream.Remote)
+		}
+		plan.Error = fmt.Sprintf("branch %s is on remotes %s, create it with --from", branch, strings.Join(remotes, ", "))
+	}
+	return plan
+}
+
+// SwitchRun switches all the repos or none of them. Nothing happens if any
+// plan has an error, and the repos already switched are switched back if a
+// later repo fails.
+func SwitchRun(plans []SwitchPlan, dryRun bool, done string) {
+	results := SwitchAll(plans, dryRun)
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, done)
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+func SwitchAll(plans []SwitchPlan, dryRun bool) []ActionResult {
+	results := make([]ActionResult, len(plans))
+
+	// refuse all if any would fail
+	refused := false
+	for i, plan := range plans {
+		results[i] = ActionResult{Dir: plan.Dir, State: ActionPlanned, Detail: plan.Detail}
+		if plan.Skip {
+			results[i] = ActionResult{Dir: plan.Dir, State: ActionSkipped, Detail: plan.Detail}
+		}
+		if plan.Error != "" {
+			results[i] = ActionResult{Dir: plan.Dir, State: ActionRefused, Detail: plan.Error}
+			refused = true
+		}
+	}
+	if refused {
+		for i := range results {
+			if results[i].State == ActionPlanned {
+				results[i] = ActionResult{Dir: plans[i].Dir, State: ActionSkipped, Detail: "not switched, other repos were refused"}
+			}
+		}
+		return results
+	}
+	if dryRun {
+		return results
+	}
+
+	for i, plan := range plans {
+		if plan.Skip {
+			continue
+		}
+		err := GitSwitch(plan)
+		if err == nil {
+			results[i] = ActionResult{Dir: plan.Dir, State: ActionDone, Detail: plan.Detail}
+			continue
+		}
+
+		// roll back
+		results[i] = ActionResult{Dir: plan.Dir, State: ActionFailed, Detail: err.Error()}
+		if err := GitSwitchUndo(plan); err != nil {
+			results[i].Detail += fmt.Sprintf(". could not roll back: %v", err)
+		}
+		for j := 0; j < i; j++ {
+			if plans[j].Skip {
+				continue
+			}
+			results[j] = ActionResult{Dir: plans[j].Dir, State: ActionSkipped, Detail: "rolled back"}
+			if err := GitSwitchUndo(plans[j]); err != nil {
+				results[j] = ActionResult{Dir: plans[j].Dir, State: ActionFailed, Detail: fmt.Sprintf("could not roll back: %v", err)}
+			}
+		}
+		for j := i + 1; j < len(plans); j++ {
+			if !plans[j].Skip {
+				results[j] = ActionResult{Dir: plans[j].Dir, State: ActionSkipped, Detail: "not started"}
+			}
+		}
+		break
+	}
+	return results
+}
+
+func GitSwitch(plan SwitchPlan) error {
+	r, err := git.PlainOpen(plan.Dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if !plan.Create {
+		err = w.Checkout(&git.CheckoutOptions{Branch: plan.Branch})
+		if err != nil {
+			return fmt.Errorf("could not check out %s: %v", plan.Branch.Short(), err)
+		}
+		return nil
+	}
+
+	err = w.Checkout(&git.CheckoutOptions{Branch: plan.Branch, Hash: plan.Hash, Create: true})
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", plan.Branch.Short(), err)
+	}
+	if plan.Upstream != nil {
+		cfg, err := r.Config()
+		if err != nil {
+			return err
+		}
+		cfg.Branches[plan.Branch.Short()] = &config.Branch{Name: plan.Branch.Short(), Remote: plan.Upstream.Remote, Merge: plan.Upstream.Merge}
+		if err := r.SetConfig(cfg); err != nil {
+			return fmt.Errorf("could not set upstream of %s: %v", plan.Branch.Short(), err)
+		}
+	}
+	return nil
+}
+
+// GitSwitchUndo restores the previous HEAD and deletes the branch if the
+// switch created it
+func GitSwitchUndo(plan SwitchPlan) error {
+	r, err := git.PlainOpen(plan.Dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	opts := &git.CheckoutOptions{Force: true}
+	prev := plan.Prev.Target().Short()
+	if plan.Prev.Type() == plumbing.SymbolicReference {
+		opts.Branch = plan.Prev.Target()
+	} else {
+		opts.Hash = plan.Prev.Hash()
+		prev = plan.Prev.Hash().String()[:7]
+	}
+	if err := w.Checkout(opts); err != nil {
+		return fmt.Errorf("could not check out %s: %v", prev, err)
+	}
+
+	if !plan.Create {
+		return nil
+	}
+	if err := r.Storer.RemoveReference(plan.Branch); err != nil {
+		return fmt.Errorf("could not delete %s: %v", plan.Branch.Short(), err)
+	}
+	if plan.Upstream == nil {
+		return nil
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	delete(cfg.Branches, plan.Branch.Short())
+	return r.SetConfig(cfg)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestSwitchAllCreatesInEveryRepo(t *testing.T) {
+	a, b := newLocalClone(t), newLocalClone(t)
+	plans := []SwitchPlan{SwitchPlanGet(a.work, "feature/x", "", true), SwitchPlanGet(b.work, "feature/x", "", true)}
+	results := SwitchAll(plans, false)
+	for _, result := range results {
+		if result.State != ActionDone {
+			t.Fatalf("unexpected results: %#v", results)
+		}
+	}
+	for _, dir := range []string{a.work, b.work} {
+		if head := headName(t, dir); head != "feature/x" {
+			t.Fatalf("%s should be on feature/x, not %s", dir, head)
+		}
+	}
+
+	results = SwitchAll([]SwitchPlan{SwitchPlanGet(a.work, "master", "", false), SwitchPlanGet(b.work, "feature/x", "", false)}, false)
+	if results[0].State != ActionDone || results[1].State != ActionSkipped {
+		t.Fatalf("unexpected checkout results: %#v", results)
+	}
+}
+
+func TestSwitchAllRefusesAllWhenOneRepoIsDirty(t *testing.T) {
+	a, b := newLocalClone(t), newLocalClone(t)
+	if err := os.WriteFile(filepath.Join(b.work, "README.md"), []byte("dirty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plans := []SwitchPlan{SwitchPlanGet(a.work, "feature/x", "", true), SwitchPlanGet(b.work, "feature/x", "", true)}
+	results := SwitchAll(plans, false)
+	if results[0].State != ActionSkipped || results[1].State != ActionRefused {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	if head := headName(t, a.work); head != "master" {
+		t.Fatalf("clean repo should not switch, is on %s", head)
+	}
+
+	plan := SwitchPlanGet(a.work, "missing", "", false)
+	if plan.Error != "no branch missing" {
+		t.Fatalf("unexpected plan error: %q", plan.Error)
+	}
+}
+
+func TestSwitchAllRollsBackAfterAFailure(t *testing.T) {
+	a, b := newLocalClone(t), newLocalClone(t)
+	plans := []SwitchPlan{SwitchPlanGet(a.work, "feature/x", "", true), SwitchPlanGet(b.work, "feature/x", "", true)}
+	plans[1].Hash = plumbing.NewHash("0123456789012345678901234567890123456789")
+	results := SwitchAll(plans, false)
+	if results[0].State != ActionSkipped || results[0].Detail != "rolled back" || results[1].State != ActionFailed {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	for _, dir := range []string{a.work, b.work} {
+		if head := headName(t, dir); head != "master" {
+			t.Fatalf("%s should be back on master, not %s", dir, head)
+		}
+		r, err := git.PlainOpen(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reference(plumbing.NewBranchReferenceName("feature/x"), false); err == nil {
+			t.Fatalf("%s should not keep feature/x", dir)
+		}
+	}
+}
+
+func TestSwitchPlanTracksRemoteBranch(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteRef := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "topic"), headHash(t, repos.work))
+	if err := r.Storer.SetReference(remoteRef); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := SwitchPlanGet(repos.work, "topic", "", false)
+	if plan.Error != "" || !plan.Create || plan.Upstream == nil || plan.Upstream.String() != "origin/topic" {
+		t.Fatalf("unexpected plan: %#v", plan)
+	}
+	if err := GitSwitch(plan); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upstream, ok := UpstreamGet(cfg, "topic"); !ok || upstream.Remote != "origin" {
+		t.Fatalf("topic should track origin/topic: %#v", upstream)
+	}
+}
+
+func headName(t *testing.T, repoPath string) string {
+	t.Helper()
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Name().Short()
+}
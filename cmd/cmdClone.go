@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	giturls "github.com/whilp/git-urls"
+	"golang.org/x/sync/errgroup"
+)
+
+func CMDCloneInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:     "clone [@group...]",
+		Aliases: []string{"sync-workspace"},
+		Short:   "Clone the missing repos of a workspace manifest or a file of urls.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDClone(v, args)
+		},
+	}
+
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	JobsFlag(c, v)
+	ManifestFlag(c, v)
+	URLsFileFlag(c, v)
+	OrphansFlag(c, v)
+	PruneFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const URLS_FILE = "from-file"
+
+func URLsFileFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringP(URLS_FILE, "f", "", "file of clone urls, one per line with an optional path after the url")
+	v.BindPFlag(URLS_FILE, c.PersistentFlags().Lookup(URLS_FILE))
+}
+
+const ORPHANS = "orphans"
+
+func OrphansFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(ORPHANS, false, "report repos under the manifest dir that are not in the manifest")
+	v.BindPFlag(ORPHANS, c.PersistentFlags().Lookup(ORPHANS))
+}
+
+const PRUNE = "prune"
+
+func PruneFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(PRUNE, false, "delete clean, pushed repos under the manifest dir that are not in the manifest, after confirmation")
+	v.BindPFlag(PRUNE, c.PersistentFlags().Lookup(PRUNE))
+}
+
+type CloneResult struct {
+	Dir    string
+	URL    string
+	Cloned bool
+	Detail string
+	Error  string
+}
+
+func CMDClone(v *viper.Viper, args []string) {
+	// get the repos to clone
+	var m *Manifest
+	var repos []ManifestRepo
+	var dirs []string
+	if urlsFile := v.GetString(URLS_FILE); urlsFile != "" {
+		var err error
+		repos, err = URLsFileRead(urlsFile)
+		if err != nil {
+			log.Fatalf("could not read urls file: %v", err)
+		}
+		for _, repo := range repos {
+			dirs = append(dirs, repo.Path)
+		}
+	} else {
+		var err error
+		m, err = ManifestGet(v)
+		if err != nil {
+			log.Fatalf("could not get manifest: %v", err)
+		}
+		if len(args) == 0 {
+			args = []string{"@" + GROUP_ALL}
+		}
+		for _, arg := range args {
+			selected := m.Select(strings.TrimPrefix(arg, "@"))
+			if len(selected) == 0 {
+				log.Fatalf("no repos in group %s of %s", arg, m.File)
+			}
+			for _, repo := range selected {
+				repos = append(repos, repo)
+				dirs = append(dirs, m.Dir(repo))
+			}
+		}
+	}
+
+	// keys are only loaded for the ssh hosts that are cloned from
+	auth := AuthResolverNew(v)
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	results := GitCloneAll(ctx, auth, repos, dirs, JobsGet(v))
+	failed := CloneResultsPrint(results)
+
+	// report or prune repos that the manifest no longer lists
+	if m != nil && (v.GetBool(ORPHANS) || v.GetBool(PRUNE)) {
+		orphans, err := ManifestOrphansGet(m)
+		if err != nil {
+			log.Fatalf("could not find orphans: %v", err)
+		}
+		for _, orphan := range orphans {
+			fmt.Printf(clrYellow + " ?  " + clrReset + fmt.Sprintf("%-40s", orphan) + " " + clrYellow + "not in manifest" + clrReset + NL)
+		}
+		if v.GetBool(PRUNE) && len(orphans) > 0 {
+			results, err := OrphansPruneCheck(ctx, m, orphans, JobsGet(v))
+			if err != nil {
+				log.Fatalf("could not check orphans: %v", err)
+			}
+			planned := 0
+			for _, result := range results {
+				if result.State == ActionPlanned {
+					planned++
+				}
+			}
+			if planned > 0 {
+				proceedResponse := Prompt(fmt.Sprintf("Delete %d clean repos not in the manifest? [y/N]: ", planned))
+				if proceedResponse != "y" && proceedResponse != "Y" {
+					log.Warnf("Cancelling prune")
+					for i := range results {
+						if results[i].State == ActionPlanned {
+							results[i].State, results[i].Detail = ActionSkipped, "cancelled"
+						}
+					}
+				} else {
+					for i := range results {
+						if results[i].State != ActionPlanned {
+							continue
+						}
+						if err := os.RemoveAll(results[i].Dir); err != nil {
+							results[i].State, results[i].Detail = ActionFailed, fmt.Sprintf("could not delete: %v", err)
+							continue
+						}
+						results[i].State, results[i].Detail = ActionDone, "deleted"
+					}
+				}
+			}
+			ActionResultsPrint(results)
+			failed += ActionFailures(results)
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d repos failed", failed)
+	}
+}
+
+// OrphansPruneCheck plans the deletion of orphans that are clean and in sync
+// with their upstreams, from the tracking refs without a fetch. Deleting an
+// orphan deletes every repo inside it, so orphans that hold a repo of the
+// manifest, or any repo with changes, stashes or unpushed branches, are
+// refused.
+func OrphansPruneCheck(ctx context.Context, m *Manifest, orphans []string, jobs int) ([]ActionResult, error) {
+	listed, err := ManifestListedGet(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// the repos inside each orphan, the orphan first
+	inside := make(map[string][]string)
+	dirs := make([]string, 0, len(orphans))
+	for _, orphan := range orphans {
+		found, err := ReposDiscover([]string{orphan}, DiscoverOpts{Nested: true})
+		if err != nil {
+			return nil, err
+		}
+		inside[orphan] = found
+		dirs = append(dirs, found...)
+	}
+	stati := GitStatiGet(ctx, nil, dirs, StatiOpts{Jobs: jobs, NoFetch: true})
+	statuses := make(map[string]Status)
+	for _, status := range stati.List() {
+		statuses[status.Dir] = status
+	}
+
+	results := make([]ActionResult, 0, len(orphans))
+	for _, orphan := range orphans {
+		result := ActionResult{Dir: orphan, State: ActionPlanned, Detail: "clean and in sync"}
+		if reason := orphanRefusalGet(orphan, listed, inside[orphan], statuses); reason != "" {
+			result.State, result.Detail = ActionRefused, reason+", not deleting"
+		}
+		results = append(results, result)
+	}
+	ActionResultsSort(results)
+	return results, nil
+}
+
+// orphanRefusalGet returns why an orphan and the repos inside it can not be
+// deleted, or "" if they can
+func orphanRefusalGet(orphan string, listed map[string]bool, inside []string, statuses map[string]Status) string {
+	abs, err := filepath.Abs(orphan)
+	if err != nil {
+		return err.Error()
+	}
+	kept := make([]string, 0)
+	for dir := range listed {
+		if dirInAny(dir, []string{abs}) {
+			rel, _ := filepath.Rel(abs, dir)
+			kept = append(kept, rel)
+		}
+	}
+	if len(kept) > 0 {
+		sort.Strings(kept)
+		return fmt.Sprintf("contains %s, which the manifest lists", strings.Join(kept, ", "))
+	}
+	for _, dir := range inside {
+		reason := PruneRefusalGet(statuses[dir])
+		if reason == "" {
+			continue
+		}
+		if dir != orphan {
+			rel, _ := filepath.Rel(orphan, dir)
+			reason = rel + ": " + reason
+		}
+		return reason
+	}
+	return ""
+}
+
+// PruneRefusalGet returns why a repo can not be deleted without losing work,
+// or "" if it can. Branches behind their upstream lose nothing.
+func PruneRefusalGet(status Status) string {
+	switch {
+	case status.Class == ClassError:
+		return status.Error
+	case status.Operation != "":
+		return status.Operation.Detail()
+	case status.Staged > 0 || status.Unstaged > 0 || status.Untracked > 0:
+		return "has uncommitted changes"
+	case status.Stashes > 0:
+		return fmt.Sprintf("has %d stashes", status.Stashes)
+	}
+	for _, b := range status.Branches {
+		if b.Sync != SyncInSync && b.Sync != SyncBehind {
+			return fmt.Sprintf("branch %s: %s", b.Name, b.Detail)
+		}
+	}
+	return ""
+}
+
+// URLsFileRead reads lines of `<url> [path]`. The path defaults to the repo
+// name of the url.
+func URLsFileRead(path string) ([]ManifestRepo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	repos := make([]ManifestRepo, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		repo := ManifestRepo{URL: fields[0]}
+		if len(fields) > 1 {
+			repo.Path = fields[1]
+		} else {
+			url, err := giturls.Parse(repo.URL)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse url %s: %v", repo.URL, err)
+			}
+			repo.Path = strings.TrimSuffix(filepath.Base(url.Path), ".git")
+		}
+		repos = append(repos, repo)
+	}
+	return repos, scanner.Err()
+}
+
+func GitCloneAll(ctx context.Context, auth *AuthResolver, repos []ManifestRepo, dirs []string, jobs int) []CloneResult {
+	results := make([]CloneResult, len(repos))
+	eg := new(errgroup.Group)
+	eg.SetLimit(jobs)
+	for i := range repos {
+		i := i
+		eg.Go(func() error {
+			results[i] = GitCloneEnsure(ctx, auth, repos[i], dirs[i])
+			return nil
+		})
+	}
+	eg.Wait()
+	return results
+}
+
+// GitCloneEnsure clones the repo unless the dir exists, in which case it
+// verifies that the dir is a clone of the repo
+func GitCloneEnsure(ctx context.Context, auth *AuthResolver, repo ManifestRepo, dir string) CloneResult {
+	result := CloneResult{Dir: dir, URL: repo.URL}
+	if repo.URL == "" {
+		result.Error = "no url in manifest"
+		return result
+	}
+
+	var r *git.Repository
+	if _, err := os.Stat(dir); err == nil {
+		r, err = git.PlainOpen(dir)
+		if err != nil {
+			result.Error = fmt.Sprintf("exists but could not open repo: %v", err)
+			return result
+		}
+		origin, err := r.Remote("origin")
+		if err != nil {
+			result.Error = fmt.Sprintf("could not get origin: %v", err)
+			return result
+		}
+		if len(origin.Config().URLs) == 0 || origin.Config().URLs[0] != repo.URL {
+			result.Error = fmt.Sprintf("origin is %v, not %s", origin.Config().URLs, repo.URL)
+			return result
+		}
+		result.Detail = "present"
+	} else {
+		fmt.Fprintf(os.Stderr, clrYellow+" cloning "+repo.URL+" into "+dir+clrReset+NL)
+		cloneAuth, err := auth.Get(repo.URL)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		opts := &git.CloneOptions{URL: repo.URL, Auth: cloneAuth, InsecureSkipTLS: auth.InsecureSkipTLS(repo.URL)}
+		if repo.Branch != "" {
+			opts.ReferenceName = plumbing.NewBranchReferenceName(repo.Branch)
+		}
+		r, err = git.PlainCloneContext(ctx, dir, false, opts)
+		if err != nil {
+			os.RemoveAll(dir)
+			result.Error = fmt.Sprintf("could not clone: %v", ErrKnownHostsWrap(err, repo.URL))
+			return result
+		}
+		result.Cloned = true
+		result.Detail = "cloned"
+	}
+
+	// add the extra remotes
+	names := make([]string, 0, len(repo.Remotes))
+	for name := range repo.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := r.Remote(name); err == nil {
+			continue
+		}
+		_, err := r.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{repo.Remotes[name]}})
+		if err != nil {
+			result.Error = fmt.Sprintf("could not add remote %s: %v", name, err)
+			return result
+		}
+		result.Detail += ", added remote " + name
+	}
+	return result
+}
+
+// CloneResultsPrint prints the results and returns the number of failures
+func CloneResultsPrint(results []CloneResult) (failed int) {
+	sort.Slice(results, func(i, j int) bool { return results[i].Dir < results[j].Dir })
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			fmt.Printf(clrRed + " x  " + clrReset + fmt.Sprintf("%-40s", result.Dir) + " " + result.Error + NL)
+			continue
+		}
+		fmt.Printf(clrGreen + " \u2714 " + clrReset + " " + fmt.Sprintf("%-40s", result.Dir) + " " + clrGreen + result.Detail + clrReset + NL)
+	}
+	return failed
+}
+
+// ManifestListedGet returns the absolute dirs of the repos in the manifest
+func ManifestListedGet(m *Manifest) (map[string]bool, error) {
+	listed := make(map[string]bool)
+	for _, repo := range m.Repos {
+		abs, err := filepath.Abs(m.Dir(repo))
+		if err != nil {
+			return nil, err
+		}
+		listed[abs] = true
+	}
+	return listed, nil
+}
+
+// ManifestOrphansGet lists repos under the manifest dir that it does not list
+func ManifestOrphansGet(m *Manifest) ([]string, error) {
+	listed, err := ManifestListedGet(m)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Dir(m.File)
+	found, err := ReposDiscover([]string{root}, DiscoverOpts{Nested: true, Ignore: []string{"node_modules"}})
+	if err != nil {
+		return nil, err
+	}
+
+	// skip the manifest dir and anything inside a listed repo or an orphan
+	var stops []string
+	orphans := make([]string, 0)
+	for _, dir := range found {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		if abs == root || dirInAny(abs, stops) {
+			continue
+		}
+		stops = append(stops, abs)
+		if !listed[abs] {
+			orphans = append(orphans, dir)
+		}
+	}
+	return orphans, nil
+}
+
+func dirInAny(dir string, parents []string) bool {
+	for _, parent := range parents {
+		if strings.HasPrefix(dir, parent+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestGitCloneAllClonesMissingAndVerifiesPresent(t *testing.T) {
+	present := newLocalClone(t)
+	missing := newLocalClone(t)
+	other := newLocalClone(t)
+
+	root := t.TempDir()
+	if err := os.Rename(present.work, filepath.Join(root, "present")); err != nil {
+		t.Fatal(err)
+	}
+	repos := []ManifestRepo{
+		{Path: "present", URL: present.origin},
+		{Path: "missing", URL: missing.origin, Branch: "master", Remotes: map[string]string{"upstream": other.origin}},
+		{Path: "wrong", URL: other.origin},
+	}
+	if err := os.Rename(missing.work, filepath.Join(root, "wrong")); err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{filepath.Join(root, "present"), filepath.Join(root, "missing"), filepath.Join(root, "wrong")}
+
+	results := GitCloneAll(context.Background(), nil, repos, dirs, 2)
+	if results[0].Error != "" || results[0].Cloned {
+		t.Fatalf("present repo should be verified: %#v", results[0])
+	}
+	if results[1].Error != "" || !results[1].Cloned {
+		t.Fatalf("missing repo should be cloned: %#v", results[1])
+	}
+	if results[2].Error == "" {
+		t.Fatalf("repo with another origin should fail verification: %#v", results[2])
+	}
+
+	r, err := git.PlainOpen(dirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Remote("upstream"); err != nil {
+		t.Fatalf("manifest remote should be added: %v", err)
+	}
+}
+
+func TestManifestOrphansGet(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"api", "stale", "api/vendor/dep"} {
+		if _, err := git.PlainInit(filepath.Join(root, rel), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Manifest{File: filepath.Join(root, MANIFEST_FILE), Repos: []ManifestRepo{{Path: "api"}}}
+
+	orphans, err := ManifestOrphansGet(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(orphans, []string{filepath.Join(root, "stale")}) {
+		t.Fatalf("unexpected orphans: %v", orphans)
+	}
+}
+
+func TestURLsFileRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	content := "# repos\ngit@github.com:org/api.git\n\nhttps://github.com/org/web.git web/app\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := URLsFileRead(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[0].Path != "api" || repos[1].Path != "web/app" {
+		t.Fatalf("unexpected repos: %#v", repos)
+	}
+}
+
+func TestOrphansPruneCheckRefusesUnsavedWork(t *testing.T) {
+	clean := newLocalClone(t)
+	ahead := newLocalClone(t)
+	commitFile(t, ahead.work, "local.txt", "local\n", "unpushed")
+	dirty := newLocalClone(t)
+	if err := os.WriteFile(filepath.Join(dirty.work, "notes.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{File: filepath.Join(t.TempDir(), MANIFEST_FILE)}
+	results, err := OrphansPruneCheck(context.Background(), m, []string{clean.work, ahead.work, dirty.work}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]ActionState)
+	for _, result := range results {
+		states[result.Dir] = result.State
+	}
+	if states[clean.work] != ActionPlanned {
+		t.Fatalf("expected a clean repo to be deleted: %#v", results)
+	}
+	if states[ahead.work] != ActionRefused || states[dirty.work] != ActionRefused {
+		t.Fatalf("expected repos with unsaved work to be refused: %#v", results)
+	}
+}
+
+func TestOrphansPruneCheckRefusesNestedRepos(t *testing.T) {
+	root := t.TempDir()
+	origin := newLocalClone(t).origin
+	for _, dir := range []string{"old", "old/sub", "stale", "stale/dep", "unused"} {
+		if _, err := git.PlainClone(filepath.Join(root, dir), false, &git.CloneOptions{URL: origin}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// keep the outer repos clean, so only the repos inside them matter
+	for dir, nested := range map[string]string{"old": "sub", "stale": "dep"} {
+		ignore := "/" + nested + "/\n/.gitignore\n"
+		if err := os.WriteFile(filepath.Join(root, dir, ".gitignore"), []byte(ignore), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a dirty repo inside an orphan
+	if err := os.WriteFile(filepath.Join(root, "stale", "dep", "notes.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the manifest still lists a repo inside an orphan
+	m := &Manifest{File: filepath.Join(root, MANIFEST_FILE), Repos: []ManifestRepo{{Path: "old/sub"}}}
+
+	orphans, err := ManifestOrphansGet(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := OrphansPruneCheck(context.Background(), m, orphans, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := make(map[string]ActionResult)
+	for _, result := range results {
+		details[filepath.Base(result.Dir)] = result
+	}
+	if len(results) != 3 || details["unused"].State != ActionPlanned {
+		t.Fatalf("expected only the clean orphan to be deleted: %#v", results)
+	}
+	if result := details["old"]; result.State != ActionRefused || !strings.Contains(result.Detail, "sub") {
+		t.Fatalf("expected the orphan with a listed repo to be refused: %#v", result)
+	}
+	if result := details["stale"]; result.State != ActionRefused || !strings.Contains(result.Detail, "dep: has uncommitted changes") {
+		t.Fatalf("expected the orphan with a dirty repo inside to be refused: %#v", result)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CMDCommitInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "commit [dirs...] -m <message>",
+		Short: "Commit the changes of every selected dirty repo with the same message.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDCommit(v, args)
+		},
+	}
+
+	DirsFlags(c, v)
+	MessageFlag(c, v)
+	AllFlag(c, v)
+	DryRunFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const MESSAGE = "message"
+
+func MessageFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringP(MESSAGE, "m", "", "commit message")
+	v.BindPFlag(MESSAGE, c.PersistentFlags().Lookup(MESSAGE))
+}
+
+const ALL = "all"
+
+func AllFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(ALL, "a", false, "also commit untracked files")
+	v.BindPFlag(ALL, c.PersistentFlags().Lookup(ALL))
+}
+
+// CommitPlan is what a commit in one repo would contain
+type CommitPlan struct {
+	Dir    string
+	Head   string
+	Author object.Signature
+	Files  []CommitFile
+	// Refused is set for repos that must not be committed to
+	Refused string
+	Error   string
+}
+
+type CommitFile struct {
+	Path string
+	Code git.StatusCode
+}
+
+func CMDCommit(v *viper.Viper, args []string) {
+	message := v.GetString(MESSAGE)
+	if strings.TrimSpace(message) == "" {
+		log.Fatalf("give a commit message with -m")
+	}
+
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	global, err := config.LoadConfig(config.GlobalScope)
+	if err != nil {
+		log.Fatalf("could not load global git config: %v", err)
+	}
+
+	// plan the commits
+	all := v.GetBool(ALL)
+	plans := make([]CommitPlan, 0)
+	for _, dir := range dirs {
+		plan := CommitPlanGet(dir, all, global)
+		if plan.Error == "" && plan.Refused == "" && len(plan.Files) == 0 {
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		log.Warnf("nothing to commit")
+		return
+	}
+
+	// confirm
+	var results []ActionResult
+	CommitPlansPrint(plans)
+	if v.GetBool(DRY_RUN) {
+		for _, plan := range plans {
+			if plan.Error != "" {
+				results = append(results, ActionResult{Dir: plan.Dir, State: ActionFailed, Detail: plan.Error})
+				continue
+			}
+			if plan.Refused != "" {
+				results = append(results, ActionResult{Dir: plan.Dir, State: ActionRefused, Detail: plan.Refused})
+				continue
+			}
+			results = append(results, ActionResult{Dir: plan.Dir, State: ActionPlanned, Detail: fmt.Sprintf("would commit %d files on %s", len(plan.Files), plan.Head)})
+		}
+	} else {
+		proceedResponse := Prompt("Commit these changes? [y/N]: ")
+		if proceedResponse != "y" && proceedResponse != "Y" {
+			log.Warnf("Cancelling commit")
+			return
+		}
+		for _, plan := range plans {
+			results = append(results, GitCommit(plan, message, all))
+		}
+	}
+	fmt.Print(NL)
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "committed")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// CommitPlanGet lists the files that a commit in dir would contain. Tracked
+// changes are always included, untracked files only with all.
+func CommitPlanGet(dir string, all bool, global *config.Config) CommitPlan {
+	plan := CommitPlan{Dir: dir, Files: make([]CommitFile, 0)}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not open repo: %v", err)
+		return plan
+	}
+	if op := OperationGet(r); op != "" {
+		plan.Refused = op.Refusal()
+		return plan
+	}
+	head, err := r.Head()
+	if err == nil && head.Name().IsBranch() {
+		plan.Head = head.Name().Short()
+	} else {
+		plan.Head = "HEAD"
+	}
+
+	author, err := CommitAuthorGet(r, global)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.Author = author
+
+	w, err := r.Worktree()
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get worktree: %v", err)
+		return plan
+	}
+	gitStatus, err := w.Status()
+	if err != nil {
+		plan.Error = fmt.Sprintf("could not get status: %v", err)
+		return plan
+	}
+	for path, s := range gitStatus {
+		switch {
+		case s.Worktree == git.Untracked:
+			if all {
+				plan.Files = append(plan.Files, CommitFile{Path: path, Code: git.Untracked})
+			}
+		case s.Staging != git.Unmodified:
+			plan.Files = append(plan.Files, CommitFile{Path: path, Code: s.Staging})
+		case s.Worktree != git.Unmodified:
+			plan.Files = append(plan.Files, CommitFile{Path: path, Code: s.Worktree})
+		}
+	}
+	sort.Slice(plan.Files, func(i, j int) bool { return plan.Files[i].Path < plan.Files[j].Path })
+	return plan
+}
+
+// CommitAuthorGet returns the identity for commits in r. The repo config
+// overrides the global config, and `author` overrides `user` in each.
+func CommitAuthorGet(r *git.Repository, global *config.Config) (object.Signature, error) {
+	local, err := r.Config()
+	if err != nil {
+		return object.Signature{}, fmt.Errorf("could not get repo config: %v", err)
+	}
+	pick := func(values ...string) string {
+		for _, value := range values {
+			if value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	author := object.Signature{
+		Name:  pick(local.Author.Name, local.User.Name, global.Author.Name, global.User.Name),
+		Email: pick(local.Author.Email, local.User.Email, global.Author.Email, global.User.Email),
+		When:  time.Now(),
+	}
+	if author.Name == "" || author.Email == "" {
+		return author, fmt.Errorf("no user.name and user.email in the repo or global git config")
+	}
+	return author, nil
+}
+
+func CommitPlansPrint(plans []CommitPlan) {
+	for _, plan := range plans {
+		if plan.Error != "" {
+			fmt.Printf(clrRed + " x  " + clrReset + fmt.Sprintf("%-40s", plan.Dir) + " " + clrRed + plan.Error + clrReset + NL)
+			continue
+		}
+		if plan.Refused != "" {
+			fmt.Printf(clrYellow + " !  " + clrReset + fmt.Sprintf("%-40s", plan.Dir) + " " + clrYellow + plan.Refused + clrReset + NL)
+			continue
+		}
+		fmt.Printf(clrYellow + fmt.Sprintf("%-44s", plan.Dir) + clrReset + " " + plan.Head + " as " + plan.Author.Name + " <" + plan.Author.Email + ">" + NL)
+		for _, file := range plan.Files {
+			fmt.Printf("    " + string(file.Code) + " " + file.Path + NL)
+		}
+	}
+	fmt.Print(NL)
+}
+
+// GitCommit stages the planned files and commits them
+func GitCommit(plan CommitPlan, message string, all bool) ActionResult {
+	result := ActionResult{Dir: plan.Dir}
+	if plan.Error != "" {
+		result.State, result.Detail = ActionFailed, plan.Error
+		return result
+	}
+	if plan.Refused != "" {
+		result.State, result.Detail = ActionRefused, plan.Refused
+		return result
+	}
+
+	r, err := git.PlainOpen(plan.Dir)
+	if err != nil {
+		result.State, result.Detail = ActionFailed, err.Error()
+		return result
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		result.State, result.Detail = ActionFailed, err.Error()
+		return result
+	}
+	if all {
+		for _, file := range plan.Files {
+			if file.Code != git.Untracked {
+				continue
+			}
+			if _, err := w.Add(file.Path); err != nil {
+				result.State, result.Detail = ActionFailed, fmt.Sprintf("could not add %s: %v", file.Path, err)
+				return result
+			}
+		}
+	}
+
+	author := plan.Author
+	author.When = time.Now()
+	hash, err := w.Commit(message, &git.CommitOptions{All: true, Author: &author})
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not commit: %v", err)
+		return result
+	}
+	result.State, result.Detail = ActionDone, fmt.Sprintf("committed %d files on %s as %s", len(plan.Files), plan.Head, hash.String()[:7])
+	return result
+}
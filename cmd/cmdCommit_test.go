@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+func TestCommitPlanAndCommit(t *testing.T) {
+	repos := newLocalClone(t)
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repos.work, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	global := config.NewConfig()
+	global.User.Name, global.User.Email = "Global", "global@example.com"
+
+	plan := CommitPlanGet(repos.work, false, global)
+	if plan.Error != "" || len(plan.Files) != 1 || plan.Files[0].Path != "README.md" || plan.Files[0].Code != git.Modified {
+		t.Fatalf("only the tracked change should be planned: %#v", plan)
+	}
+	if plan.Author.Name != "Global" {
+		t.Fatalf("author should come from the global config: %#v", plan.Author)
+	}
+
+	plan = CommitPlanGet(repos.work, true, global)
+	if len(plan.Files) != 2 || plan.Files[1].Path != "new.txt" || plan.Files[1].Code != git.Untracked {
+		t.Fatalf("all should plan the untracked file: %#v", plan.Files)
+	}
+
+	result := GitCommit(plan, "mechanical change", true)
+	if result.State != ActionDone {
+		t.Fatalf("commit failed: %#v", result)
+	}
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.CommitObject(headHash(t, repos.work))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Message != "mechanical change" || commit.Author.Email != "global@example.com" {
+		t.Fatalf("unexpected commit: %#v", commit)
+	}
+	if plan = CommitPlanGet(repos.work, true, global); len(plan.Files) != 0 {
+		t.Fatalf("repo should be clean after the commit: %#v", plan.Files)
+	}
+}
+
+func TestCommitAuthorGetPrefersRepoIdentity(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Email = "work@example.com"
+	if err := r.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	global := config.NewConfig()
+	global.User.Name, global.User.Email = "Global", "global@example.com"
+	author, err := CommitAuthorGet(r, global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if author.Name != "Global" || author.Email != "work@example.com" {
+		t.Fatalf("repo email should override the global one: %#v", author)
+	}
+
+	if _, err := CommitAuthorGet(r, config.NewConfig()); err == nil {
+		t.Fatal("missing name should be an error")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+func CMDExecInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "exec [dirs...] -- <cmd> [args...]",
+		Short: "Run a command in every selected repo.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			dash := cmd.ArgsLenAtDash()
+			if dash < 0 || dash == len(args) {
+				log.Fatalf("give the command to run after --")
+			}
+			CMDExec(v, args[:dash], args[dash:])
+		},
+	}
+
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	StatiOptsFlags(c, v)
+	DirsFlags(c, v)
+	OnlyFlag(c, v)
+	BufferFlag(c, v)
+	FailFastFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const ONLY = "only"
+
+func OnlyFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(ONLY, nil, "only repos in all these states: dirty, clean, ahead, behind, diverged, gone, no_upstream, needs_sync, needs_commit, has_stash, in_sync, in_progress, error, merging, rebasing, applying, cherry_picking, reverting, bisecting")
+	v.BindPFlag(ONLY, c.PersistentFlags().Lookup(ONLY))
+}
+
+const BUFFER = "buffer"
+
+func BufferFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(BUFFER, false, "print the output of each repo at once when it finishes instead of prefixing lines")
+	v.BindPFlag(BUFFER, c.PersistentFlags().Lookup(BUFFER))
+}
+
+const FAIL_FAST = "fail-fast"
+
+func FailFastFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(FAIL_FAST, false, "stop all repos after the first failure")
+	v.BindPFlag(FAIL_FAST, c.PersistentFlags().Lookup(FAIL_FAST))
+}
+
+type ExecOpts struct {
+	Jobs     int
+	Buffer   bool
+	FailFast bool
+}
+
+func CMDExec(v *viper.Viper, args []string, command []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	// filter by status
+	only := v.GetStringSlice(ONLY)
+	if len(only) > 0 {
+		for _, state := range only {
+			if !StatusStateValid(state) {
+				log.Fatalf("unknown state %q for --only", state)
+			}
+		}
+		statiOpts := StatiOptsGet(v)
+		s := GitStatiGet(ctx, StatiAuthGet(v, statiOpts), dirs, statiOpts)
+		dirs = dirs[:0]
+		for _, status := range s.List() {
+			if StatusIs(status, only...) {
+				dirs = append(dirs, status.Dir)
+			}
+		}
+	}
+
+	opts := ExecOpts{Jobs: JobsGet(v), Buffer: v.GetBool(BUFFER), FailFast: v.GetBool(FAIL_FAST)}
+	results := ExecAll(ctx, os.Stdout, dirs, command, opts)
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "ok")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// ExecAll runs the command in each dir and returns a result per dir
+func ExecAll(ctx context.Context, out io.Writer, dirs []string, command []string, opts ExecOpts) []ActionResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	results := make([]ActionResult, len(dirs))
+	eg := new(errgroup.Group)
+	eg.SetLimit(opts.Jobs)
+	for i, dir := range dirs {
+		i, dir := i, dir
+		eg.Go(func() error {
+			if ctx.Err() != nil {
+				results[i] = ActionResult{Dir: dir, State: ActionSkipped, Detail: "not started"}
+				return nil
+			}
+
+			var buf bytes.Buffer
+			var w io.Writer = &buf
+			var pw *prefixWriter
+			if !opts.Buffer {
+				pw = &prefixWriter{out: out, mu: &mu, prefix: clrYellow + dir + ": " + clrReset}
+				w = pw
+			}
+
+			cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+			cmd.Dir = dir
+			cmd.Stdout = w
+			cmd.Stderr = w
+			err := cmd.Run()
+
+			if pw != nil {
+				pw.Flush()
+			} else {
+				mu.Lock()
+				fmt.Fprintf(out, clrYellow+"==> "+dir+clrReset+NL)
+				out.Write(buf.Bytes())
+				mu.Unlock()
+			}
+
+			results[i] = ActionResult{Dir: dir, State: ActionDone, Detail: "exit 0"}
+			if err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					results[i] = ActionResult{Dir: dir, State: ActionFailed, Detail: fmt.Sprintf("exit %d", exitErr.ExitCode())}
+				} else {
+					results[i] = ActionResult{Dir: dir, State: ActionFailed, Detail: err.Error()}
+				}
+				if opts.FailFast {
+					cancel()
+				}
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	return results
+}
+
+// prefixWriter writes whole lines to out with a prefix
+type prefixWriter struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.mu.Lock()
+		_, err := io.WriteString(w.out, w.prefix+string(w.buf[:i+1]))
+		w.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes a trailing partial line
+func (w *prefixWriter) Flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	w.mu.Lock()
+	io.WriteString(w.out, w.prefix+string(w.buf)+NL)
+	w.mu.Unlock()
+	w.buf = nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecAllPrefixesOutputAndCollectsExitCodes(t *testing.T) {
+	ok := t.TempDir()
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "fail"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	command := []string{"sh", "-c", "echo hello; test ! -e fail || exit 3"}
+	results := ExecAll(context.Background(), &out, []string{ok, bad}, command, ExecOpts{Jobs: 2})
+	if results[0].State != ActionDone || results[1].State != ActionFailed || results[1].Detail != "exit 3" {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	for _, dir := range []string{ok, bad} {
+		if !strings.Contains(out.String(), dir+": "+clrReset+"hello\n") {
+			t.Fatalf("output should be prefixed with %s: %q", dir, out.String())
+		}
+	}
+
+	out.Reset()
+	results = ExecAll(context.Background(), &out, []string{bad, ok}, command, ExecOpts{Jobs: 1, Buffer: true, FailFast: true})
+	if results[0].State != ActionFailed || results[1].State != ActionSkipped {
+		t.Fatalf("fail fast should skip the rest: %#v", results)
+	}
+	if !strings.Contains(out.String(), "==> "+bad) {
+		t.Fatalf("buffered output should have a header: %q", out.String())
+	}
+}
+
+func TestStatusIs(t *testing.T) {
+	status := Status{
+		Class:    ClassNeedsSync,
+		Unstaged: 1,
+		Branches: []BranchStatus{{Name: "master", Sync: SyncBehind}, {Name: "topic", Sync: SyncNoUpstream}},
+	}
+	for _, states := range [][]string{{"dirty"}, {"behind"}, {"dirty", "behind"}, {"needs_sync"}, {"no_upstream"}} {
+		if !StatusIs(status, states...) {
+			t.Fatalf("status should be %v", states)
+		}
+	}
+	for _, states := range [][]string{{"clean"}, {"ahead"}, {"dirty", "ahead"}, {"in_sync"}} {
+		if StatusIs(status, states...) {
+			t.Fatalf("status should not be %v", states)
+		}
+	}
+	if StatusStateValid("bogus") {
+		t.Fatal("bogus should not be a valid state")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+func CMDGrepInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "grep <pattern> [dirs...]",
+		Short: "Search the committed files of every selected repo at a revision.",
+		// Long:  ``,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDGrep(v, args[0], args[1:])
+		},
+	}
+
+	JobsFlag(c, v)
+	DirsFlags(c, v)
+	RefFlag(c, v)
+	PathGlobFlag(c, v)
+	CountFlag(c, v)
+	OutputFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const REF = "ref"
+
+func RefFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(REF, "HEAD", "branch, tag or commit to search. repos without it are skipped")
+	v.BindPFlag(REF, c.PersistentFlags().Lookup(REF))
+}
+
+const PATH_GLOB = "path-glob"
+
+func PathGlobFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(PATH_GLOB, nil, "only search files matching these globs, eg *.go or cmd/**")
+	v.BindPFlag(PATH_GLOB, c.PersistentFlags().Lookup(PATH_GLOB))
+}
+
+const COUNT = "count"
+
+func CountFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(COUNT, "c", false, "only print the number of matching lines per repo")
+	v.BindPFlag(COUNT, c.PersistentFlags().Lookup(COUNT))
+}
+
+type GrepOpts struct {
+	Pattern   *regexp.Regexp
+	Ref       string
+	PathSpecs []*regexp.Regexp
+}
+
+// GrepMatch is a matching line in a committed file
+type GrepMatch struct {
+	Repo string `json:"repo" yaml:"repo"`
+	Path string `json:"path" yaml:"path"`
+	Line int    `json:"line" yaml:"line"`
+	Text string `json:"text" yaml:"text"`
+}
+
+type GrepCount struct {
+	Repo  string `json:"repo" yaml:"repo"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+func CMDGrep(v *viper.Viper, pattern string, args []string) {
+	output, err := OutputGet(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Fatalf("could not compile pattern: %v", err)
+	}
+	opts := GrepOpts{Pattern: re, Ref: v.GetString(REF)}
+	for _, glob := range v.GetStringSlice(PATH_GLOB) {
+		pathSpec, err := GlobRegexp(glob)
+		if err != nil {
+			log.Fatalf("could not compile path glob %s: %v", glob, err)
+		}
+		opts.PathSpecs = append(opts.PathSpecs, pathSpec)
+	}
+
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	matches := GitGrepAll(ctx, dirs, opts, JobsGet(v))
+	if v.GetBool(COUNT) {
+		counts := GrepCountsGet(matches)
+		if output == OUTPUT_TEXT {
+			for _, count := range counts {
+				fmt.Printf(clrYellow+"%s"+clrReset+": %d"+NL, count.Repo, count.Count)
+			}
+			return
+		}
+		if err := OutputWrite(os.Stdout, output, counts); err != nil {
+			log.Fatalf("could not write output: %v", err)
+		}
+		return
+	}
+	if output == OUTPUT_TEXT {
+		GrepMatchesPrint(os.Stdout, matches)
+		return
+	}
+	if err := OutputWrite(os.Stdout, output, matches); err != nil {
+		log.Fatalf("could not write output: %v", err)
+	}
+}
+
+// GlobRegexp turns a path glob into a regexp for go-git path specs. * and ?
+// stay within a path segment and ** crosses segments. A glob without a / matches
+// the file name in any dir.
+func GlobRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		b.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// GitGrepAll greps the repos in parallel and sorts the matches by repo, path
+// and line
+func GitGrepAll(ctx context.Context, dirs []string, opts GrepOpts, jobs int) []GrepMatch {
+	var mu sync.Mutex
+	matches := make([]GrepMatch, 0)
+	eg := new(errgroup.Group)
+	eg.SetLimit(jobs)
+	for _, dir := range dirs {
+		dir := dir
+		eg.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			repoMatches, err := GitGrep(dir, opts)
+			if err != nil {
+				log.Errorf("could not grep %s: %v", dir, err)
+				return nil
+			}
+			mu.Lock()
+			matches = append(matches, repoMatches...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	eg.Wait()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Repo != matches[j].Repo {
+			return matches[i].Repo < matches[j].Repo
+		}
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].Line < matches[j].Line
+	})
+	return matches
+}
+
+// GitGrep searches the tree of opts.Ref in the repo at dir. Lines of binary
+// files are dropped.
+func GitGrep(dir string, opts GrepOpts) ([]GrepMatch, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(opts.Ref))
+	if err != nil {
+		log.Debugf("%s has no %s", dir, opts.Ref)
+		return nil, nil
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	results, err := w.Grep(&git.GrepOptions{Patterns: []*regexp.Regexp{opts.Pattern}, CommitHash: *hash, PathSpecs: opts.PathSpecs})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]GrepMatch, 0, len(results))
+	for _, result := range results {
+		if strings.ContainsRune(result.Content, 0) {
+			continue
+		}
+		matches = append(matches, GrepMatch{Repo: dir, Path: result.FileName, Line: result.LineNumber, Text: result.Content})
+	}
+	return matches, nil
+}
+
+// GrepCountsGet counts the matches per repo. matches are sorted by repo.
+func GrepCountsGet(matches []GrepMatch) []GrepCount {
+	counts := make([]GrepCount, 0)
+	for _, match := range matches {
+		if len(counts) == 0 || counts[len(counts)-1].Repo != match.Repo {
+			counts = append(counts, GrepCount{Repo: match.Repo})
+		}
+		counts[len(counts)-1].Count++
+	}
+	return counts
+}
+
+func GrepMatchesPrint(w io.Writer, matches []GrepMatch) {
+	for _, match := range matches {
+		fmt.Fprintf(w, clrYellow+"%s"+clrReset+":%s:%d: %s"+NL, match.Repo, match.Path, match.Line, match.Text)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestGitGrepAllSearchesTheRef(t *testing.T) {
+	a, b := newLocalClone(t), newLocalClone(t)
+	commitFile(t, a.work, "cmd/main.go", "package main\n\nfunc FindMe() {}\n", "add main")
+	commitFile(t, b.work, "notes.txt", "FindMe later\n", "add notes")
+	commitFile(t, b.work, "notes.txt", "gone\n", "drop notes")
+
+	opts := GrepOpts{Pattern: regexp.MustCompile(`FindMe`), Ref: "HEAD"}
+	matches := GitGrepAll(context.Background(), []string{b.work, a.work}, opts, 2)
+	if len(matches) != 1 || matches[0].Repo != a.work || matches[0].Path != "cmd/main.go" || matches[0].Line != 3 || matches[0].Text != "func FindMe() {}" {
+		t.Fatalf("unexpected matches at HEAD: %#v", matches)
+	}
+
+	opts.Ref = "HEAD~1"
+	matches = GitGrepAll(context.Background(), []string{a.work, b.work}, opts, 2)
+	if len(matches) != 1 || matches[0].Repo != b.work {
+		t.Fatalf("the old notes should match at HEAD~1: %#v", matches)
+	}
+
+	glob, err := GlobRegexp("*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = GrepOpts{Pattern: regexp.MustCompile(`.`), Ref: "HEAD", PathSpecs: []*regexp.Regexp{glob}}
+	counts := GrepCountsGet(GitGrepAll(context.Background(), []string{a.work, b.work}, opts, 2))
+	if len(counts) != 1 || counts[0].Repo != b.work || counts[0].Count != 1 {
+		t.Fatalf("unexpected counts: %#v", counts)
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	for glob, paths := range map[string]map[string]bool{
+		"*.go":     {"main.go": true, "cmd/main.go": true, "main.go.orig": false},
+		"cmd/*":    {"cmd/main.go": true, "cmd/sub/main.go": false, "x/cmd/main.go": false},
+		"cmd/**":   {"cmd/sub/main.go": true, "main.go": false},
+		"file?.md": {"file1.md": true, "file12.md": false},
+	} {
+		re, err := GlobRegexp(glob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, want := range paths {
+			if re.MatchString(path) != want {
+				t.Fatalf("%s matching %s should be %v", glob, path, want)
+			}
+		}
+	}
+}
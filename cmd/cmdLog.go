@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+func CMDLogInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "log [dirs...]",
+		Short: "Show the commits of every selected repo in one timeline.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDLog(v, args)
+		},
+	}
+
+	JobsFlag(c, v)
+	DirsFlags(c, v)
+	SinceFlag(c, v)
+	AuthorFlag(c, v)
+	PathFlag(c, v)
+	BranchFlag(c, v)
+	LogOutputFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const SINCE = "since"
+
+func SinceFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(SINCE, "1w", "only commits after this age (eg 12h, 3d, 1w) or date (eg 2006-01-02)")
+	v.BindPFlag(SINCE, c.PersistentFlags().Lookup(SINCE))
+}
+
+const AUTHOR = "author"
+
+func AuthorFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(AUTHOR, "", "only commits with an author name or email containing this")
+	v.BindPFlag(AUTHOR, c.PersistentFlags().Lookup(AUTHOR))
+}
+
+const PATH = "path"
+
+func PathFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(PATH, nil, "only commits touching these paths or globs")
+	v.BindPFlag(PATH, c.PersistentFlags().Lookup(PATH))
+}
+
+const BRANCH = "branch"
+
+func BranchFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(BRANCH, "", "log this branch instead of HEAD. repos without it are skipped")
+	v.BindPFlag(BRANCH, c.PersistentFlags().Lookup(BRANCH))
+}
+
+func LogOutputFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringP(OUTPUT, "o", OUTPUT_TEXT, "output format: text, json, yaml, ndjson or markdown")
+	v.BindPFlag(OUTPUT, c.PersistentFlags().Lookup(OUTPUT))
+}
+
+func LogOutputGet(v *viper.Viper) (string, error) {
+	if v.GetString(OUTPUT) == OUTPUT_MARKDOWN {
+		return OUTPUT_MARKDOWN, nil
+	}
+	return OutputGet(v)
+}
+
+type LogOpts struct {
+	Since  time.Time
+	Author string
+	Paths  []string
+	Branch string
+}
+
+// LogEntry is a commit in the timeline
+type LogEntry struct {
+	Repo    string    `json:"repo" yaml:"repo"`
+	Hash    string    `json:"hash" yaml:"hash"`
+	Author  string    `json:"author" yaml:"author"`
+	Email   string    `json:"email" yaml:"email"`
+	When    time.Time `json:"when" yaml:"when"`
+	Subject string    `json:"subject" yaml:"subject"`
+}
+
+func CMDLog(v *viper.Viper, args []string) {
+	output, err := LogOutputGet(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	since, err := SinceParse(v.GetString(SINCE), time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	opts := LogOpts{Since: since, Author: v.GetString(AUTHOR), Paths: v.GetStringSlice(PATH), Branch: v.GetString(BRANCH)}
+	entries := GitLogAll(ctx, dirs, opts, JobsGet(v))
+	switch output {
+	case OUTPUT_TEXT:
+		LogEntriesPrint(os.Stdout, entries)
+	case OUTPUT_MARKDOWN:
+		LogEntriesMarkdownWrite(os.Stdout, entries, since)
+	default:
+		if err := OutputWrite(os.Stdout, output, entries); err != nil {
+			log.Fatalf("could not write output: %v", err)
+		}
+	}
+}
+
+var sinceRegexp = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+
+// SinceParse reads an age like 12h, 3d, 1w, 2m or 1y, or a date
+func SinceParse(since string, now time.Time) (time.Time, error) {
+	if m := sinceRegexp.FindStringSubmatch(since); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "m":
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("could not parse --since %q. use an age like 3d or 1w, or a date like 2006-01-02", since)
+}
+
+// GitLogAll logs the repos in parallel and merges their commits newest first
+func GitLogAll(ctx context.Context, dirs []string, opts LogOpts, jobs int) []LogEntry {
+	var mu sync.Mutex
+	entries := make([]LogEntry, 0)
+	eg := new(errgroup.Group)
+	eg.SetLimit(jobs)
+	for _, dir := range dirs {
+		dir := dir
+		eg.Go(func() error {
+			repoEntries, err := GitLog(ctx, dir, opts)
+			if err != nil {
+				log.Errorf("could not log %s: %v", dir, err)
+				return nil
+			}
+			mu.Lock()
+			entries = append(entries, repoEntries...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	eg.Wait()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].When.Equal(entries[j].When) {
+			return entries[i].When.After(entries[j].When)
+		}
+		return entries[i].Repo < entries[j].Repo
+	})
+	return entries
+}
+
+// GitLog walks the commits of a repo by committer time and stops at the
+// first one older than opts.Since
+func GitLog(ctx context.Context, dir string, opts LogOpts) ([]LogEntry, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var from *plumbing.Reference
+	if opts.Branch != "" {
+		from, err = r.Reference(plumbing.NewBranchReferenceName(opts.Branch), true)
+		if err != nil {
+			log.Debugf("%s has no branch %s", dir, opts.Branch)
+			return nil, nil
+		}
+	} else {
+		from, err = r.Head()
+		if err == plumbing.ErrReferenceNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get HEAD: %v", err)
+		}
+	}
+
+	logOpts := &git.LogOptions{From: from.Hash(), Order: git.LogOrderCommitterTime}
+	if len(opts.Paths) > 0 {
+		logOpts.PathFilter = func(path string) bool { return LogPathMatch(opts.Paths, path) }
+	}
+	iter, err := r.Log(logOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	author := strings.ToLower(opts.Author)
+	entries := make([]LogEntry, 0)
+	err = iter.ForEach(func(c *object.Commit) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.Committer.When.Before(opts.Since) {
+			return storer.ErrStop
+		}
+		if author != "" && !strings.Contains(strings.ToLower(c.Author.Name), author) && !strings.Contains(strings.ToLower(c.Author.Email), author) {
+			return nil
+		}
+		entries = append(entries, LogEntry{
+			Repo:    dir,
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			Email:   c.Author.Email,
+			When:    c.Committer.When,
+			Subject: strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// LogPathMatch is true if path is under or matches one of the patterns
+func LogPathMatch(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if path == pattern || strings.HasPrefix(path, pattern+"/") {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func LogEntriesPrint(w io.Writer, entries []LogEntry) {
+	width := 0
+	for _, entry := range entries {
+		if len(entry.Repo) > width {
+			width = len(entry.Repo)
+		}
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s  "+clrYellow+"%-*s"+clrReset+"  %s  %-20s %s"+NL,
+			entry.When.Local().Format("2006-01-02 15:04"), width, entry.Repo, entry.Hash[:7], entry.Author, entry.Subject)
+	}
+}
+
+// LogEntriesMarkdownWrite writes a summary with a section per repo
+func LogEntriesMarkdownWrite(w io.Writer, entries []LogEntry, since time.Time) {
+	byRepo := make(map[string][]LogEntry)
+	repos := make([]string, 0)
+	for _, entry := range entries {
+		if _, ok := byRepo[entry.Repo]; !ok {
+			repos = append(repos, entry.Repo)
+		}
+		byRepo[entry.Repo] = append(byRepo[entry.Repo], entry)
+	}
+	sort.Strings(repos)
+
+	fmt.Fprintf(w, "# Commits since %s"+NL+NL, since.Format("2006-01-02"))
+	if len(repos) == 0 {
+		fmt.Fprint(w, "No commits."+NL)
+		return
+	}
+	for _, repo := range repos {
+		fmt.Fprintf(w, "## %s (%d)"+NL+NL, repo, len(byRepo[repo]))
+		for _, entry := range byRepo[repo] {
+			fmt.Fprintf(w, "- %s (`%s`, %s, %s)"+NL, entry.Subject, entry.Hash[:7], entry.Author, entry.When.Format("2006-01-02"))
+		}
+		fmt.Fprint(w, NL)
+	}
+}
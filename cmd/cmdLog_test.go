@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitLogAllMergesAndFilters(t *testing.T) {
+	a, b := newLocalClone(t), newLocalClone(t)
+	commitFile(t, a.work, "docs/guide.md", "guide\n", "add guide")
+	time.Sleep(1100 * time.Millisecond)
+	commitFile(t, b.work, "main.go", "package main\n", "add main")
+
+	since := time.Now().Add(-time.Hour)
+	entries := GitLogAll(context.Background(), []string{a.work, b.work}, LogOpts{Since: since}, 2)
+	if len(entries) != 4 || entries[0].Subject != "add main" || entries[0].Repo != b.work {
+		t.Fatalf("newest commit should come first: %#v", entries)
+	}
+
+	entries = GitLogAll(context.Background(), []string{a.work, b.work}, LogOpts{Since: since, Paths: []string{"docs"}}, 2)
+	if len(entries) != 1 || entries[0].Subject != "add guide" {
+		t.Fatalf("path filter should keep the docs commit: %#v", entries)
+	}
+	entries = GitLogAll(context.Background(), []string{a.work, b.work}, LogOpts{Since: since, Paths: []string{"*.go"}}, 2)
+	if len(entries) != 1 || entries[0].Subject != "add main" {
+		t.Fatalf("glob filter should keep the go commit: %#v", entries)
+	}
+
+	if entries := GitLogAll(context.Background(), []string{a.work}, LogOpts{Since: since, Author: "nobody"}, 1); len(entries) != 0 {
+		t.Fatalf("author filter should drop everything: %#v", entries)
+	}
+	if entries := GitLogAll(context.Background(), []string{a.work}, LogOpts{Since: since, Author: "TEST@example"}, 1); len(entries) != 2 {
+		t.Fatalf("author filter should match emails: %#v", entries)
+	}
+	if entries := GitLogAll(context.Background(), []string{a.work}, LogOpts{Since: since, Branch: "missing"}, 1); len(entries) != 0 {
+		t.Fatalf("repos without the branch should be skipped: %#v", entries)
+	}
+	if entries := GitLogAll(context.Background(), []string{a.work}, LogOpts{Since: time.Now().Add(time.Hour)}, 1); len(entries) != 0 {
+		t.Fatalf("since should stop the walk: %#v", entries)
+	}
+
+	var out bytes.Buffer
+	LogEntriesMarkdownWrite(&out, GitLogAll(context.Background(), []string{a.work, b.work}, LogOpts{Since: since}, 2), since)
+	if !strings.Contains(out.String(), "## "+a.work+" (2)\n") || !strings.Contains(out.String(), "- add guide (`") {
+		t.Fatalf("unexpected markdown: %s", out.String())
+	}
+}
+
+func TestSinceParse(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	for since, want := range map[string]time.Time{
+		"12h":        time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		"3d":         time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC),
+		"1w":         time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC),
+		"2m":         time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		"2024-01-02": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	} {
+		got, err := SinceParse(since, now)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("SinceParse(%q) = %v, %v, want %v", since, got, err, want)
+		}
+	}
+	if _, err := SinceParse("last week", now); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CMDPullInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "pull",
+		Short: "Fast-forward clean repos that are behind their upstream.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDPull(v, args)
+		},
+	}
+
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	StatiOptsFlags(c, v)
+	DirsFlags(c, v)
+	AllBranchesFlag(c, v)
+	DryRunFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const ALL_BRANCHES = "all-branches"
+
+func AllBranchesFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(ALL_BRANCHES, false, "also update branches that are not checked out")
+	v.BindPFlag(ALL_BRANCHES, c.PersistentFlags().Lookup(ALL_BRANCHES))
+}
+
+const DRY_RUN = "dry-run"
+
+func DryRunFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(DRY_RUN, "n", false, "report what would change without changing anything")
+	v.BindPFlag(DRY_RUN, c.PersistentFlags().Lookup(DRY_RUN))
+}
+
+type PullOpts struct {
+	AllBranches bool
+	DryRun      bool
+}
+
+func CMDPull(v *viper.Viper, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	opts := StatiOptsGet(v)
+	auth := StatiAuthGet(v, opts)
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	s := GitStatiGet(ctx, auth, dirs, opts)
+	pullOpts := PullOpts{AllBranches: v.GetBool(ALL_BRANCHES), DryRun: v.GetBool(DRY_RUN)}
+	var results []ActionResult
+	for _, status := range s.List() {
+		results = append(results, GitPull(status, pullOpts)...)
+	}
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "pulled")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// GitPull fast-forwards the branches of a repo that are strictly behind
+// their upstream. Repos with errors or changes are refused.
+func GitPull(status Status, opts PullOpts) []ActionResult {
+	results := make([]ActionResult, 0)
+	result := func(branch string, state ActionState, detail string) {
+		results = append(results, ActionResult{Dir: status.Dir, Branch: branch, State: state, Detail: detail})
+	}
+
+	if status.Class == ClassError {
+		result(status.Head, ActionFailed, status.Error)
+		return results
+	}
+	if status.Operation != "" {
+		result(status.Head, ActionRefused, status.Operation.Refusal())
+		return results
+	}
+	if status.Staged+status.Unstaged+status.Untracked > 0 {
+		result(status.Head, ActionRefused, status.Detail)
+		return results
+	}
+
+	r, err := git.PlainOpen(status.Dir)
+	if err != nil {
+		result(status.Head, ActionFailed, err.Error())
+		return results
+	}
+
+	for _, b := range status.Branches {
+		checkedOut := b.Name == status.Head
+		if !checkedOut && !opts.AllBranches {
+			continue
+		}
+
+		switch b.Sync {
+		case SyncBehind:
+			// handled below
+		case SyncDiverged:
+			result(b.Name, ActionRefused, fmt.Sprintf("diverged from %s %s, not a fast-forward", b.Upstream, AheadBehindText(b)))
+			continue
+		case SyncGone:
+			result(b.Name, ActionRefused, b.Detail)
+			continue
+		default:
+			result(b.Name, ActionSkipped, b.Detail)
+			continue
+		}
+
+		if opts.DryRun {
+			result(b.Name, ActionPlanned, fmt.Sprintf("would fast-forward %d commits from %s", b.Behind, b.Upstream))
+			continue
+		}
+		err := GitFastForward(r, b.Name, checkedOut)
+		if err != nil {
+			result(b.Name, ActionFailed, err.Error())
+			continue
+		}
+		result(b.Name, ActionDone, fmt.Sprintf("fast-forwarded %d commits from %s", b.Behind, b.Upstream))
+	}
+	return results
+}
+
+// GitFastForward moves a branch to its upstream commit after checking that
+// this is a fast-forward. The worktree follows when the branch is checked out.
+func GitFastForward(r *git.Repository, branch string, checkedOut bool) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	upstream, ok := UpstreamGet(cfg, branch)
+	if !ok {
+		return fmt.Errorf("%s has no upstream", branch)
+	}
+	upstreamRef, err := r.Reference(upstream.RefName(cfg), true)
+	if err != nil {
+		return fmt.Errorf("could not get %s: %v", upstream, err)
+	}
+	localRef, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return fmt.Errorf("could not get %s: %v", branch, err)
+	}
+
+	ab, err := AheadBehindGet(r, localRef.Hash(), upstreamRef.Hash())
+	if err != nil {
+		return err
+	}
+	if ab.State() != SyncBehind {
+		return fmt.Errorf("%s is %s of %s, not a fast-forward", branch, ab.State(), upstream)
+	}
+
+	if !checkedOut {
+		newRef := plumbing.NewHashReference(localRef.Name(), upstreamRef.Hash())
+		return r.Storer.CheckAndSetReference(newRef, localRef)
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{Commit: upstreamRef.Hash(), Mode: git.MergeReset})
+}
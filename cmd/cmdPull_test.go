@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestGitPullFastForwardsBehindRepos(t *testing.T) {
+	repos := newLocalClone(t)
+	want := commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status := s.NeedsSyncList[repos.work]
+
+	results := GitPull(status, PullOpts{DryRun: true})
+	if len(results) != 1 || results[0].State != ActionPlanned {
+		t.Fatalf("dry run should only plan: %#v", results)
+	}
+	if headHash(t, repos.work) == want {
+		t.Fatal("dry run must not move the branch")
+	}
+
+	results = GitPull(status, PullOpts{})
+	if len(results) != 1 || results[0].State != ActionDone {
+		t.Fatalf("behind repo should fast-forward: %#v", results)
+	}
+	if headHash(t, repos.work) != want {
+		t.Fatal("branch should point at the origin commit")
+	}
+	content, err := os.ReadFile(filepath.Join(repos.work, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new origin commit\n" {
+		t.Fatalf("worktree should be updated: %q", content)
+	}
+}
+
+func TestGitPullRefusesDirtyAndDivergedRepos(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("dirty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	results := GitPull(s.NeedsSyncList[repos.work], PullOpts{})
+	if len(results) != 1 || results[0].State != ActionRefused {
+		t.Fatalf("dirty repo should be refused: %#v", results)
+	}
+
+	repos = newLocalClone(t)
+	commitFile(t, repos.origin, "a.txt", "a\n", "advance origin")
+	commitFile(t, repos.work, "b.txt", "b\n", "advance work")
+	s = GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	results = GitPull(s.NeedsSyncList[repos.work], PullOpts{})
+	if len(results) != 1 || results[0].State != ActionRefused {
+		t.Fatalf("diverged repo should be refused: %#v", results)
+	}
+}
+
+func TestGitPullAllBranchesUpdatesRefs(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("other"), head.Hash())); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateBranch(&config.Branch{Name: "other", Remote: "origin", Merge: "refs/heads/master"}); err != nil {
+		t.Fatal(err)
+	}
+	want := commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	results := GitPull(s.NeedsSyncList[repos.work], PullOpts{AllBranches: true})
+	if len(results) != 2 || ActionFailures(results) != 0 {
+		t.Fatalf("both branches should fast-forward: %#v", results)
+	}
+	if refHash(t, r, plumbing.NewBranchReferenceName("other")) != want {
+		t.Fatal("other branch should be fast-forwarded")
+	}
+}
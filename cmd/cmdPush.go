@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func CMDPushInit() {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "push",
+		Short: "Push the branches that are strictly ahead of their upstream.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDPush(v, args)
+		},
+	}
+
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	StatiOptsFlags(c, v)
+	DirsFlags(c, v)
+	SetUpstreamFlag(c, v)
+	DryRunFlag(c, v)
+	MAIN.AddCommand(c)
+}
+
+const SET_UPSTREAM = "set-upstream"
+
+func SetUpstreamFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(SET_UPSTREAM, "u", false, "push the checked out branch to origin and track it when it has no upstream")
+	v.BindPFlag(SET_UPSTREAM, c.PersistentFlags().Lookup(SET_UPSTREAM))
+}
+
+type PushOpts struct {
+	SetUpstream bool
+	DryRun      bool
+}
+
+func CMDPush(v *viper.Viper, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	auth := AuthResolverNew(v)
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	s := GitStatiGet(ctx, auth, dirs, StatiOptsGet(v))
+	pushOpts := PushOpts{SetUpstream: v.GetBool(SET_UPSTREAM), DryRun: v.GetBool(DRY_RUN)}
+	var results []ActionResult
+	for _, status := range s.List() {
+		results = append(results, GitPush(ctx, auth, status, pushOpts)...)
+	}
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "pushed")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// GitPush pushes the branches of a repo that are strictly ahead of their
+// upstream. Diverged branches are refused.
+func GitPush(ctx context.Context, auth *AuthResolver, status Status, opts PushOpts) []ActionResult {
+	results := make([]ActionResult, 0)
+	result := func(branch string, state ActionState, detail string) {
+		results = append(results, ActionResult{Dir: status.Dir, Branch: branch, State: state, Detail: detail})
+	}
+
+	if status.Class == ClassError {
+		result(status.Head, ActionFailed, status.Error)
+		return results
+	}
+	if status.Operation != "" {
+		result(status.Head, ActionRefused, status.Operation.Refusal())
+		return results
+	}
+
+	r, err := git.PlainOpen(status.Dir)
+	if err != nil {
+		result(status.Head, ActionFailed, err.Error())
+		return results
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		result(status.Head, ActionFailed, err.Error())
+		return results
+	}
+
+	for _, b := range status.Branches {
+		var upstream Upstream
+		switch b.Sync {
+		case SyncAhead:
+			upstream, _ = UpstreamGet(cfg, b.Name)
+		case SyncNoUpstream:
+			if !opts.SetUpstream || b.Name != status.Head {
+				result(b.Name, ActionSkipped, b.Detail)
+				continue
+			}
+			upstream = Upstream{Remote: "origin", Merge: plumbing.NewBranchReferenceName(b.Name)}
+		case SyncDiverged:
+			result(b.Name, ActionRefused, fmt.Sprintf("diverged from %s %s. pull and rebase or merge first", b.Upstream, AheadBehindText(b)))
+			continue
+		case SyncGone:
+			result(b.Name, ActionRefused, b.Detail)
+			continue
+		default:
+			result(b.Name, ActionSkipped, b.Detail)
+			continue
+		}
+		if upstream.IsLocal() {
+			result(b.Name, ActionSkipped, "upstream is the local branch "+upstream.String())
+			continue
+		}
+
+		if opts.DryRun {
+			result(b.Name, ActionPlanned, fmt.Sprintf("would push %s to %s", b.Name, upstream))
+			continue
+		}
+		err := GitPushBranch(ctx, r, auth, b.Name, upstream)
+		if err != nil {
+			result(b.Name, ActionFailed, err.Error())
+			continue
+		}
+		detail := fmt.Sprintf("pushed %d commits to %s", b.Ahead, upstream)
+		if b.Sync == SyncNoUpstream {
+			cfg.Branches[b.Name] = &config.Branch{Name: b.Name, Remote: upstream.Remote, Merge: upstream.Merge}
+			if err := r.SetConfig(cfg); err != nil {
+				result(b.Name, ActionFailed, fmt.Sprintf("pushed to %s but could not set upstream: %v", upstream, err))
+				continue
+			}
+			detail = fmt.Sprintf("pushed to %s and set upstream", upstream)
+		}
+		result(b.Name, ActionDone, detail)
+	}
+	return results
+}
+
+func GitPushBranch(ctx context.Context, r *git.Repository, auth *AuthResolver, branch string, upstream Upstream) error {
+	refSpec := config.RefSpec(plumbing.NewBranchReferenceName(branch).String() + ":" + upstream.Merge.String())
+	url, err := RemoteURLGet(r, upstream.Remote)
+	if err != nil {
+		return err
+	}
+	pushAuth, err := auth.Get(url)
+	if err != nil {
+		return err
+	}
+	opts := &git.PushOptions{RemoteName: upstream.Remote, RefSpecs: []config.RefSpec{refSpec}, Auth: pushAuth, InsecureSkipTLS: auth.InsecureSkipTLS(url)}
+	err = r.PushContext(ctx, opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("could not push to %s: %v", upstream, ErrKnownHostsWrap(err, url))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestGitPushPushesAheadBranches(t *testing.T) {
+	repos := newLocalClone(t)
+	want := commitFile(t, repos.work, "a.txt", "a\n", "advance work")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	results := GitPush(context.Background(), nil, s.NeedsSyncList[repos.work], PushOpts{})
+	if len(results) != 1 || results[0].State != ActionDone {
+		t.Fatalf("ahead branch should be pushed: %#v", results)
+	}
+	if headHash(t, repos.origin) != want {
+		t.Fatal("origin should have the pushed commit")
+	}
+}
+
+func TestGitPushRefusesDivergedBranches(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.origin, "a.txt", "a\n", "advance origin")
+	commitFile(t, repos.work, "b.txt", "b\n", "advance work")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	results := GitPush(context.Background(), nil, s.NeedsSyncList[repos.work], PushOpts{})
+	if len(results) != 1 || results[0].State != ActionRefused {
+		t.Fatalf("diverged branch should be refused: %#v", results)
+	}
+}
+
+func TestGitPushSetUpstream(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := commitFile(t, repos.work, "a.txt", "a\n", "feature work")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status := s.NeedsNothingList[repos.work]
+	results := GitPush(context.Background(), nil, status, PushOpts{})
+	for _, result := range results {
+		if result.State != ActionSkipped {
+			t.Fatalf("without --set-upstream nothing should be pushed: %#v", results)
+		}
+	}
+
+	results = GitPush(context.Background(), nil, status, PushOpts{SetUpstream: true})
+	if ActionFailures(results) != 0 {
+		t.Fatalf("unexpected failures: %#v", results)
+	}
+	origin, err := git.PlainOpen(repos.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refHash(t, origin, plumbing.NewBranchReferenceName("feature")) != want {
+		t.Fatal("origin should have the feature branch")
+	}
+
+	s = GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	for _, b := range s.NeedsNothingList[repos.work].Branches {
+		if b.Name == "feature" && (b.Upstream != "origin/feature" || b.Sync != SyncInSync) {
+			t.Fatalf("feature should track origin/feature: %#v", b)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func CMDSnapshotInit() {
+	// CLI Command with subcommands
+	c := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save, restore and compare the exact commits of a set of repos.",
+	}
+	c.AddCommand(CMDSnapshotSaveInit())
+	c.AddCommand(CMDSnapshotRestoreInit())
+	c.AddCommand(CMDSnapshotDiffInit())
+	MAIN.AddCommand(c)
+}
+
+func CMDSnapshotSaveInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "save <file> [dirs...]",
+		Short: "Write the path, remote, branch and HEAD of each repo to a yaml or json lock file.",
+		// Long:  ``,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDSnapshotSave(v, args[0], args[1:])
+		},
+	}
+
+	DirsFlags(c, v)
+	return c
+}
+
+func CMDSnapshotRestoreInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Check out the commits of a lock file, cloning and fetching as needed.",
+		// Long:  ``,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDSnapshotRestore(v, args[0])
+		},
+	}
+
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	FetchTimeoutFlag(c, v)
+	DryRunFlag(c, v)
+	return c
+}
+
+func CMDSnapshotDiffInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "diff <a> <b>",
+		Short: "Show which repos moved between two lock files, and by how many commits.",
+		// Long:  ``,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDSnapshotDiff(v, args[0], args[1])
+		},
+	}
+
+	OutputFlag(c, v)
+	return c
+}
+
+// Snapshot is the content of a lock file. Repo paths are relative to the
+// dir of the lock file.
+type Snapshot struct {
+	Created time.Time      `json:"created" yaml:"created"`
+	Repos   []SnapshotRepo `json:"repos" yaml:"repos"`
+}
+
+type SnapshotRepo struct {
+	Path   string `json:"path" yaml:"path"`
+	URL    string `json:"url,omitempty" yaml:"url,omitempty"`
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Head   string `json:"head" yaml:"head"`
+	Dirty  bool   `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+}
+
+func CMDSnapshotSave(v *viper.Viper, file string, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	snapshot := Snapshot{Created: time.Now().UTC().Truncate(time.Second), Repos: make([]SnapshotRepo, 0, len(dirs))}
+	for _, dir := range dirs {
+		repo, err := SnapshotRepoGet(dir, filepath.Dir(file))
+		if err != nil {
+			log.Fatalf("could not snapshot %s: %v", dir, err)
+		}
+		if repo.Dirty {
+			log.Warnf("%s has uncommitted changes that are not in the snapshot", dir)
+		}
+		snapshot.Repos = append(snapshot.Repos, repo)
+	}
+	sort.Slice(snapshot.Repos, func(i, j int) bool { return snapshot.Repos[i].Path < snapshot.Repos[j].Path })
+
+	if err := SnapshotWrite(file, snapshot); err != nil {
+		log.Fatalf("could not write snapshot: %v", err)
+	}
+	log.Infof("saved %d repos to %s", len(snapshot.Repos), file)
+}
+
+// SnapshotRepoGet records the state of the repo in dir with a path relative
+// to base
+func SnapshotRepoGet(dir string, base string) (SnapshotRepo, error) {
+	var repo SnapshotRepo
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return repo, err
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return repo, err
+	}
+	repo.Path, err = filepath.Rel(absBase, absDir)
+	if err != nil {
+		return repo, err
+	}
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return repo, fmt.Errorf("could not open repo: %v", err)
+	}
+	if origin, err := r.Remote("origin"); err == nil && len(origin.Config().URLs) > 0 {
+		repo.URL = origin.Config().URLs[0]
+	}
+	head, err := r.Head()
+	if err != nil {
+		return repo, fmt.Errorf("could not get HEAD: %v", err)
+	}
+	repo.Head = head.Hash().String()
+	if head.Name().IsBranch() {
+		repo.Branch = head.Name().Short()
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return repo, fmt.Errorf("could not get worktree: %v", err)
+	}
+	gitStatus, err := w.Status()
+	if err != nil {
+		return repo, fmt.Errorf("could not get status: %v", err)
+	}
+	repo.Dirty = !gitStatus.IsClean()
+	return repo, nil
+}
+
+// SnapshotWrite writes json for .json files and yaml otherwise
+func SnapshotWrite(file string, snapshot Snapshot) error {
+	var data []byte
+	var err error
+	if filepath.Ext(file) == ".json" {
+		data, err = json.MarshalIndent(snapshot, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func SnapshotRead(file string) (*Snapshot, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if filepath.Ext(file) == ".json" {
+		err = json.Unmarshal(data, snapshot)
+	} else {
+		err = yaml.Unmarshal(data, snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", file, err)
+	}
+	for _, repo := range snapshot.Repos {
+		if repo.Path == "" || !plumbing.IsHash(repo.Head) {
+			return nil, fmt.Errorf("%s has a repo without a path or a full head sha", file)
+		}
+	}
+	return snapshot, nil
+}
+
+func CMDSnapshotRestore(v *viper.Viper, file string) {
+	snapshot, err := SnapshotRead(file)
+	if err != nil {
+		log.Fatalf("could not read snapshot: %v", err)
+	}
+
+	// keys are only loaded for the ssh hosts that have to be reached
+	auth := AuthResolverNew(v)
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	opts := StatiOpts{FetchTimeout: FetchTimeoutGet(v)}
+	dryRun := v.GetBool(DRY_RUN)
+	results := make([]ActionResult, 0, len(snapshot.Repos))
+	for _, repo := range snapshot.Repos {
+		dir := filepath.Join(filepath.Dir(file), repo.Path)
+		results = append(results, SnapshotRestore(ctx, auth, dir, repo, opts, dryRun))
+	}
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "restored")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// SnapshotRestore checks out the snapshot commit in dir. The recorded branch
+// is checked out if it is still at the commit, otherwise HEAD is detached.
+// Branches are never moved.
+func SnapshotRestore(ctx context.Context, auth *AuthResolver, dir string, repo SnapshotRepo, opts StatiOpts, dryRun bool) ActionResult {
+	result := ActionResult{Dir: dir}
+	short := repo.Head[:7]
+
+	if _, err := os.Stat(dir); err != nil {
+		if dryRun {
+			result.State, result.Detail = ActionPlanned, fmt.Sprintf("would clone %s and check out %s", repo.URL, short)
+			return result
+		}
+		clone := GitCloneEnsure(ctx, auth, ManifestRepo{URL: repo.URL, Branch: repo.Branch}, dir)
+		if clone.Error != "" {
+			result.State, result.Detail = ActionFailed, clone.Error
+			return result
+		}
+	}
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not open repo: %v", err)
+		return result
+	}
+	if err := OperationCheck(r); err != nil {
+		result.State, result.Detail = ActionRefused, err.Error()
+		return result
+	}
+	hash := plumbing.NewHash(repo.Head)
+
+	// fetch every remote if the commit is missing
+	if _, err := r.CommitObject(hash); err != nil {
+		if dryRun {
+			result.State, result.Detail = ActionPlanned, fmt.Sprintf("would fetch and check out %s", short)
+			return result
+		}
+		remotes, err := r.Remotes()
+		if err != nil {
+			result.State, result.Detail = ActionFailed, fmt.Sprintf("could not get remotes: %v", err)
+			return result
+		}
+		for _, remote := range remotes {
+			if err := GitFetch(ctx, r, remote.Config().Name, auth, dir, opts); err != nil {
+				result.State, result.Detail = ActionFailed, err.Error()
+				return result
+			}
+		}
+		if err := FetchedTouch(r); err != nil {
+			log.Warnf("could not record the fetch time in %s: %v", dir, err)
+		}
+		if _, err := r.CommitObject(hash); err != nil {
+			result.State, result.Detail = ActionFailed, fmt.Sprintf("commit %s is not on any remote", short)
+			return result
+		}
+	}
+
+	// pick the branch or a detached HEAD
+	checkoutOpts := &git.CheckoutOptions{Hash: hash}
+	target := "detached at " + short
+	if repo.Branch != "" {
+		ref, err := r.Reference(plumbing.NewBranchReferenceName(repo.Branch), true)
+		if err == nil && ref.Hash() == hash {
+			checkoutOpts = &git.CheckoutOptions{Branch: ref.Name()}
+			target = repo.Branch + " at " + short
+		}
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not get worktree: %v", err)
+		return result
+	}
+	gitStatus, err := w.Status()
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not get status: %v", err)
+		return result
+	}
+	head, err := r.Head()
+	if err == nil && head.Hash() == hash && (checkoutOpts.Branch == "" || head.Name() == checkoutOpts.Branch) {
+		result.State, result.Detail = ActionSkipped, "already "+target
+		return result
+	}
+	if !gitStatus.IsClean() {
+		result.State, result.Detail = ActionRefused, "has uncommitted changes"
+		return result
+	}
+
+	if dryRun {
+		result.State, result.Detail = ActionPlanned, "would check out "+target
+		return result
+	}
+	if err := w.Checkout(checkoutOpts); err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not check out %s: %v", short, err)
+		return result
+	}
+	result.State, result.Detail = ActionDone, "checked out "+target
+	return result
+}
+
+// SnapshotChange is how a repo differs between two snapshots
+type SnapshotChange struct {
+	Path   string `json:"path" yaml:"path"`
+	State  string `json:"state" yaml:"state"`
+	From   string `json:"from,omitempty" yaml:"from,omitempty"`
+	To     string `json:"to,omitempty" yaml:"to,omitempty"`
+	Ahead  int    `json:"ahead" yaml:"ahead"`
+	Behind int    `json:"behind" yaml:"behind"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+const (
+	SnapshotSame    = "same"
+	SnapshotMoved   = "moved"
+	SnapshotAdded   = "added"
+	SnapshotRemoved = "removed"
+)
+
+func CMDSnapshotDiff(v *viper.Viper, fileA string, fileB string) {
+	output, err := OutputGet(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a, err := SnapshotRead(fileA)
+	if err != nil {
+		log.Fatalf("could not read snapshot: %v", err)
+	}
+	b, err := SnapshotRead(fileB)
+	if err != nil {
+		log.Fatalf("could not read snapshot: %v", err)
+	}
+
+	changes := SnapshotDiffGet(a, b, filepath.Dir(fileB))
+	if output != OUTPUT_TEXT {
+		if err := OutputWrite(os.Stdout, output, changes); err != nil {
+			log.Fatalf("could not write output: %v", err)
+		}
+		return
+	}
+	SnapshotChangesPrint(changes)
+}
+
+// SnapshotDiffGet compares the repos of a and b by path. Commits are counted
+// in the local clones under base, Ahead being the commits that b has and a
+// does not.
+func SnapshotDiffGet(a *Snapshot, b *Snapshot, base string) []SnapshotChange {
+	from := make(map[string]SnapshotRepo)
+	for _, repo := range a.Repos {
+		from[repo.Path] = repo
+	}
+
+	changes := make([]SnapshotChange, 0)
+	for _, repo := range b.Repos {
+		old, ok := from[repo.Path]
+		if !ok {
+			changes = append(changes, SnapshotChange{Path: repo.Path, State: SnapshotAdded, To: repo.Head})
+			continue
+		}
+		delete(from, repo.Path)
+
+		change := SnapshotChange{Path: repo.Path, State: SnapshotSame, From: old.Head, To: repo.Head}
+		if old.Head != repo.Head {
+			change.State = SnapshotMoved
+			r, err := git.PlainOpen(filepath.Join(base, repo.Path))
+			if err == nil {
+				var ab AheadBehind
+				ab, err = AheadBehindGet(r, plumbing.NewHash(repo.Head), plumbing.NewHash(old.Head))
+				change.Ahead, change.Behind = ab.Ahead, ab.Behind
+			}
+			if err != nil {
+				change.Detail = fmt.Sprintf("could not count commits: %v", err)
+			}
+		}
+		changes = append(changes, change)
+	}
+	for _, repo := range from {
+		changes = append(changes, SnapshotChange{Path: repo.Path, State: SnapshotRemoved, From: repo.Head})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func SnapshotChangesPrint(changes []SnapshotChange) {
+	moved := 0
+	for _, change := range changes {
+		var marker, clr, detail string
+		switch change.State {
+		case SnapshotSame:
+			marker, clr, detail = " =  ", clrReset, change.To[:7]
+		case SnapshotAdded:
+			marker, clr, detail = " +  ", clrGreen, "added at "+change.To[:7]
+		case SnapshotRemoved:
+			marker, clr, detail = " -  ", clrRed, "removed, was "+change.From[:7]
+		default:
+			moved++
+			marker, clr = " ~  ", clrYellow
+			parts := []string{change.From[:7] + ".." + change.To[:7]}
+			if change.Detail != "" {
+				parts = append(parts, change.Detail)
+			} else {
+				parts = append(parts, fmt.Sprintf("+%d -%d", change.Ahead, change.Behind))
+			}
+			detail = strings.Join(parts, " ")
+		}
+		fmt.Printf(clr + marker + clrReset + fmt.Sprintf("%-40s", change.Path) + " " + clr + detail + clrReset + NL)
+	}
+	fmt.Printf(NL+"%d of %d repos moved"+NL, moved, len(changes))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotSaveRestoreAndDiff(t *testing.T) {
+	repos := newLocalClone(t)
+	root := filepath.Dir(repos.work)
+
+	before, err := SnapshotRepoGet(repos.work, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Path != "work" || before.Branch != "master" || before.URL != repos.origin || before.Dirty {
+		t.Fatalf("unexpected snapshot repo: %#v", before)
+	}
+	fileA := filepath.Join(root, "a.json")
+	if err := SnapshotWrite(fileA, Snapshot{Repos: []SnapshotRepo{before}}); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile(t, repos.work, "one.txt", "1\n", "one")
+	commitFile(t, repos.work, "two.txt", "2\n", "two")
+	after, err := SnapshotRepoGet(repos.work, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileB := filepath.Join(root, "b.yaml")
+	if err := SnapshotWrite(fileB, Snapshot{Repos: []SnapshotRepo{after, {Path: "other", Head: after.Head}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := SnapshotRead(fileA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SnapshotRead(fileB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := SnapshotDiffGet(a, b, root)
+	if len(changes) != 2 || changes[0].State != SnapshotAdded || changes[1].State != SnapshotMoved || changes[1].Ahead != 2 || changes[1].Behind != 0 {
+		t.Fatalf("unexpected changes: %#v", changes)
+	}
+
+	// master moved on, so the old commit is restored detached
+	result := SnapshotRestore(context.Background(), nil, repos.work, a.Repos[0], StatiOpts{}, false)
+	if result.State != ActionDone || result.Detail != "checked out detached at "+before.Head[:7] {
+		t.Fatalf("unexpected restore: %#v", result)
+	}
+	if headHash(t, repos.work).String() != before.Head {
+		t.Fatal("HEAD should be at the snapshot commit")
+	}
+	result = SnapshotRestore(context.Background(), nil, repos.work, b.Repos[0], StatiOpts{}, false)
+	if result.State != ActionDone || result.Detail != "checked out master at "+after.Head[:7] {
+		t.Fatalf("unexpected restore: %#v", result)
+	}
+}
+
+func TestSnapshotRestoreFetchesMissingCommits(t *testing.T) {
+	repos := newLocalClone(t)
+	hash := commitFile(t, repos.origin, "later.txt", "later\n", "later")
+	repo := SnapshotRepo{Path: "work", URL: repos.origin, Branch: "master", Head: hash.String()}
+
+	result := SnapshotRestore(context.Background(), nil, repos.work, repo, StatiOpts{}, true)
+	if result.State != ActionPlanned || !strings.Contains(result.Detail, "would fetch") {
+		t.Fatalf("the commit is only on origin: %#v", result)
+	}
+	result = SnapshotRestore(context.Background(), nil, repos.work, repo, StatiOpts{}, false)
+	if result.State != ActionDone || headHash(t, repos.work) != hash {
+		t.Fatalf("unexpected restore: %#v", result)
+	}
+}
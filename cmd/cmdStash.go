@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// go-git can not stash, so save and pop run the git cli. Listing and
+// counting read the stash reflog directly.
+
+const STASH_MESSAGE = "gitall stash"
+
+func CMDStashInit() {
+	// CLI Command with subcommands
+	c := &cobra.Command{
+		Use:   "stash",
+		Short: "List, save and pop stashes across repos.",
+	}
+	c.AddCommand(CMDStashListInit())
+	c.AddCommand(CMDStashSaveInit())
+	c.AddCommand(CMDStashPopInit())
+	MAIN.AddCommand(c)
+}
+
+func CMDStashListInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "list [dirs...]",
+		Short: "List the stashes of every selected repo.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDStashList(v, args)
+		},
+	}
+
+	DirsFlags(c, v)
+	OutputFlag(c, v)
+	return c
+}
+
+func CMDStashSaveInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "save [dirs...]",
+		Short: "Stash the changes of every selected dirty repo.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDStashSave(v, args)
+		},
+	}
+
+	DirsFlags(c, v)
+	StashMessageFlag(c, v)
+	IncludeUntrackedFlag(c, v)
+	DryRunFlag(c, v)
+	return c
+}
+
+func CMDStashPopInit() *cobra.Command {
+	// A general configuration object (feed with flags, conf files, etc.)
+	v := viper.New()
+
+	// CLI Command with flag parsing
+	c := &cobra.Command{
+		Use:   "pop [dirs...]",
+		Short: "Pop the latest stash of every selected repo that `stash save` made.",
+		// Long:  ``,
+		Run: func(cmd *cobra.Command, args []string) {
+			CMDStashPop(v, args)
+		},
+	}
+
+	DirsFlags(c, v)
+	StashMessageFlag(c, v)
+	AnyFlag(c, v)
+	DryRunFlag(c, v)
+	return c
+}
+
+func StashMessageFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringP(MESSAGE, "m", STASH_MESSAGE, "stash message. pop only pops stashes with this message")
+	v.BindPFlag(MESSAGE, c.PersistentFlags().Lookup(MESSAGE))
+}
+
+const INCLUDE_UNTRACKED = "include-untracked"
+
+func IncludeUntrackedFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(INCLUDE_UNTRACKED, "u", false, "also stash untracked files")
+	v.BindPFlag(INCLUDE_UNTRACKED, c.PersistentFlags().Lookup(INCLUDE_UNTRACKED))
+}
+
+const ANY = "any"
+
+func AnyFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(ANY, false, "pop the latest stash whatever its message")
+	v.BindPFlag(ANY, c.PersistentFlags().Lookup(ANY))
+}
+
+// StashEntry is a stash in the reflog of refs/stash
+type StashEntry struct {
+	Repo    string `json:"repo" yaml:"repo"`
+	Index   int    `json:"index" yaml:"index"`
+	Hash    string `json:"hash" yaml:"hash"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (e StashEntry) Name() string {
+	return fmt.Sprintf("stash@{%d}", e.Index)
+}
+
+// StashListGet reads the stashes of a repo, newest first
+func StashListGet(r *git.Repository, dir string) ([]StashEntry, error) {
+	entries := make([]StashEntry, 0)
+	storage, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return entries, nil
+	}
+	f, err := storage.Filesystem().Open("logs/refs/stash")
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open stash log: %v", err)
+	}
+	defer f.Close()
+
+	// lines are `<old> <new> <name> <email> <time> <tz>\t<message>`
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read stash log: %v", err)
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		entry := StashEntry{Repo: dir, Index: len(lines) - 1 - i}
+		head, message, _ := strings.Cut(lines[i], "\t")
+		if fields := strings.Fields(head); len(fields) > 1 {
+			entry.Hash = fields[1]
+		}
+		entry.Message = message
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func StashCountGet(r *git.Repository) (int, error) {
+	entries, err := StashListGet(r, "")
+	return len(entries), err
+}
+
+// StashMessageIs is true if the stash was saved with message. git prefixes
+// messages with `On <branch>: `.
+func StashMessageIs(entry StashEntry, message string) bool {
+	return entry.Message == message || strings.HasSuffix(entry.Message, ": "+message)
+}
+
+func CMDStashList(v *viper.Viper, args []string) {
+	output, err := OutputGet(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	all := make([]StashEntry, 0)
+	for _, dir := range dirs {
+		r, err := git.PlainOpen(dir)
+		if err != nil {
+			log.Errorf("could not open %s: %v", dir, err)
+			continue
+		}
+		entries, err := StashListGet(r, dir)
+		if err != nil {
+			log.Errorf("could not list stashes of %s: %v", dir, err)
+			continue
+		}
+		all = append(all, entries...)
+	}
+
+	if output != OUTPUT_TEXT {
+		if err := OutputWrite(os.Stdout, output, all); err != nil {
+			log.Fatalf("could not write output: %v", err)
+		}
+		return
+	}
+	dir := ""
+	for _, entry := range all {
+		if entry.Repo != dir {
+			dir = entry.Repo
+			fmt.Printf(clrPurple + dir + clrReset + NL)
+		}
+		hash := entry.Hash
+		if len(hash) > 7 {
+			hash = hash[:7]
+		}
+		fmt.Printf("    " + fmt.Sprintf("%-10s", entry.Name()) + " " + hash + " " + entry.Message + NL)
+	}
+}
+
+func CMDStashSave(v *viper.Viper, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	results := make([]ActionResult, 0, len(dirs))
+	for _, dir := range dirs {
+		results = append(results, GitStashSave(dir, v.GetString(MESSAGE), v.GetBool(INCLUDE_UNTRACKED), v.GetBool(DRY_RUN)))
+	}
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "stashed")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// GitStashSave stashes the changes of a dirty repo. Untracked files only
+// count with includeUntracked.
+func GitStashSave(dir string, message string, includeUntracked bool, dryRun bool) ActionResult {
+	result := ActionResult{Dir: dir}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not open repo: %v", err)
+		return result
+	}
+	if err := OperationCheck(r); err != nil {
+		result.State, result.Detail = ActionRefused, err.Error()
+		return result
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not get worktree: %v", err)
+		return result
+	}
+	gitStatus, err := w.Status()
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not get status: %v", err)
+		return result
+	}
+	changes := 0
+	for _, fs := range gitStatus {
+		if fs.Worktree == git.Untracked && !includeUntracked {
+			continue
+		}
+		changes++
+	}
+	if changes == 0 {
+		result.State, result.Detail = ActionSkipped, "nothing to stash"
+		return result
+	}
+
+	if dryRun {
+		result.State, result.Detail = ActionPlanned, fmt.Sprintf("would stash %d files", changes)
+		return result
+	}
+	gitArgs := []string{"stash", "push", "-m", message}
+	if includeUntracked {
+		gitArgs = append(gitArgs, "--include-untracked")
+	}
+	if err := GitCLIRun(dir, gitArgs...); err != nil {
+		result.State, result.Detail = ActionFailed, err.Error()
+		return result
+	}
+	result.State, result.Detail = ActionDone, fmt.Sprintf("stashed %d files", changes)
+	return result
+}
+
+func CMDStashPop(v *viper.Viper, args []string) {
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	message := v.GetString(MESSAGE)
+	if v.GetBool(ANY) {
+		message = ""
+	}
+	results := make([]ActionResult, 0, len(dirs))
+	for _, dir := range dirs {
+		results = append(results, GitStashPop(dir, message, v.GetBool(DRY_RUN)))
+	}
+	ActionResultsPrint(results)
+	ActionSummaryPrint(results, "popped")
+	if ActionFailures(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// GitStashPop pops the latest stash if it has the message, or any latest
+// stash when message is empty
+func GitStashPop(dir string, message string, dryRun bool) ActionResult {
+	result := ActionResult{Dir: dir}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		result.State, result.Detail = ActionFailed, fmt.Sprintf("could not open repo: %v", err)
+		return result
+	}
+	if err := OperationCheck(r); err != nil {
+		result.State, result.Detail = ActionRefused, err.Error()
+		return result
+	}
+	entries, err := StashListGet(r, dir)
+	if err != nil {
+		result.State, result.Detail = ActionFailed, err.Error()
+		return result
+	}
+	if len(entries) == 0 {
+		result.State, result.Detail = ActionSkipped, "no stashes"
+		return result
+	}
+	latest := entries[0]
+	if message != "" && !StashMessageIs(latest, message) {
+		result.State, result.Detail = ActionSkipped, fmt.Sprintf("%s is %q, pop it with --any", latest.Name(), latest.Message)
+		return result
+	}
+
+	if dryRun {
+		result.State, result.Detail = ActionPlanned, "would pop "+latest.Message
+		return result
+	}
+	if err := GitCLIRun(dir, "stash", "pop"); err != nil {
+		result.State, result.Detail = ActionFailed, err.Error()
+		return result
+	}
+	result.State, result.Detail = ActionDone, "popped "+latest.Message
+	return result
+}
+
+// GitCLIRun runs the git cli in dir. The error has the last line of output.
+func GitCLIRun(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("git %s failed: %v: %s", args[0], err, lines[len(lines)-1])
+	}
+	return nil
+}
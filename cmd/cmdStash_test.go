@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestStashSavePopAndStatus(t *testing.T) {
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(key, "Test User")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "test@example.com")
+	}
+
+	repos := newLocalClone(t)
+	if result := GitStashSave(repos.work, STASH_MESSAGE, false, false); result.State != ActionSkipped {
+		t.Fatalf("clean repo has nothing to stash: %#v", result)
+	}
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("parked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := GitStashSave(repos.work, STASH_MESSAGE, false, false); result.State != ActionDone {
+		t.Fatalf("stash failed: %#v", result)
+	}
+
+	// a repo with only a stash gets its own class
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{NoFetch: true})
+	status, ok := s.HasStashList[repos.work]
+	if !ok || status.Stashes != 1 || status.Detail != "has 1 stashes" || !StatusIs(status, "has_stash", "clean") {
+		t.Fatalf("repo should have a stash: %#v", s)
+	}
+	if StashText(status) != "" {
+		t.Fatalf("the has_stash detail already names the stashes: %q", StashText(status))
+	}
+
+	// other classes still show the stashes
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("more\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{NoFetch: true})
+	status = s.NeedsCommitList[repos.work]
+	if StashText(status) != ", has 1 stashes" {
+		t.Fatalf("expected the stash count on a dirty repo: %#v", status)
+	}
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("initial\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := StashListGet(r, repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "stash@{0}" || !StashMessageIs(entries[0], STASH_MESSAGE) || len(entries[0].Hash) != 40 {
+		t.Fatalf("unexpected stash list: %#v", entries)
+	}
+
+	if result := GitStashPop(repos.work, "other", false); result.State != ActionSkipped {
+		t.Fatalf("stash with another message should not pop: %#v", result)
+	}
+	if result := GitStashPop(repos.work, STASH_MESSAGE, false); result.State != ActionDone {
+		t.Fatalf("pop failed: %#v", result)
+	}
+	data, err := os.ReadFile(filepath.Join(repos.work, "README.md"))
+	if err != nil || string(data) != "parked\n" {
+		t.Fatalf("pop should restore the change: %q %v", data, err)
+	}
+	if n, err := StashCountGet(r); err != nil || n != 0 {
+		t.Fatalf("stash should be empty: %d %v", n, err)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -22,15 +24,38 @@ func CMDStatusInit() {
 
 	PrvKFilePathFlag(c, v)
 	PrvKPasswordFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
+	StatiOptsFlags(c, v)
+	DirsFlags(c, v)
+	OutputFlag(c, v)
 	MAIN.AddCommand(c)
 }
 
-func CMDStatus(v *viper.Viper, dirs []string) {
-	publicKeys, err := PubKsGet(v)
+func CMDStatus(v *viper.Viper, args []string) {
+	output, err := OutputGet(v)
 	if err != nil {
-		log.Fatalf("could not get publicKeys: %v", err)
+		log.Fatalf("could not get output format: %v", err)
 	}
 
-	s := GitStatiGet(publicKeys, dirs)
-	StatiPrint(s)
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	opts := StatiOptsGet(v)
+	auth := StatiAuthGet(v, opts)
+
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+
+	s := GitStatiGet(ctx, auth, dirs, opts)
+	if output == OUTPUT_TEXT {
+		StatiPrint(s)
+		return
+	}
+	err = OutputWrite(os.Stdout, output, s.List())
+	if err != nil {
+		log.Fatalf("could not write status: %v", err)
+	}
 }
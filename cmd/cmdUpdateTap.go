@@ -34,9 +34,11 @@ func CMDUpdateTapInit() {
 
 	PrvKFilePathFlag(c, v)
 	PrvKPasswordFlag(c, v)
-	GithubPassFlag(c, v)
-	GithubUserFlag(c, v)
+	InsecureSkipTLSFlag(c, v)
+	StrictHostKeysFlag(c, v)
 	BrewTapRepoLocalPathFlag(c, v)
+	StatiOptsFlags(c, v)
+	DirsFlags(c, v)
 	MAIN.AddCommand(c)
 }
 
@@ -55,20 +57,25 @@ func BrewTapRepoLocalPath(v *viper.Viper) string {
 	return brewTapRepoPath
 }
 
-func CMDUpdateTap(v *viper.Viper, dirs []string) {
-	// get public keys for git
-	publicKeys, err := PubKsGet(v)
+func CMDUpdateTap(v *viper.Viper, args []string) {
+	dirs, err := DirsGet(v, args)
 	if err != nil {
-		log.Fatalf("could not get publicKeys: %v", err)
+		log.Fatalf("could not get repo dirs: %v", err)
 	}
 
-	client, err := GithubClientGet(v)
+	// get auth for git
+	opts := StatiOptsGet(v)
+	auth := StatiAuthGet(v, opts)
+
+	client, err := GithubClientGet()
 	if err != nil {
 		log.Fatalf("could not get github client: %v", err)
 	}
 
 	// get the status of requested dirs
-	s := GitStatiGet(publicKeys, dirs)
+	ctx, cancel := InterruptCtxGet()
+	defer cancel()
+	s := GitStatiGet(ctx, auth, dirs, opts)
 	StatiPrint(s)
 
 	// commit changes to the tap
@@ -76,18 +83,28 @@ func CMDUpdateTap(v *viper.Viper, dirs []string) {
 	if err != nil {
 		log.Fatalf("error opening git repo for %s: %v", BrewTapRepoLocalPath(v), err)
 	}
+	if err := OperationCheck(tapRepo); err != nil {
+		log.Fatalf("can not update the tap repo: %v", err)
+	}
 	tapWorktree, err := tapRepo.Worktree()
 	if err != nil {
 		log.Fatalf("error getting worktree for tap repo: %v", err)
 	}
 
-	if len(s.NeedsNothingList) == 0 {
+	// stashes are local, so repos that only have stashes are in sync too
+	inSync := make([]Status, 0, len(s.NeedsNothingList)+len(s.HasStashList))
+	for _, m := range []map[string]Status{s.NeedsNothingList, s.HasStashList} {
+		for _, status := range m {
+			inSync = append(inSync, status)
+		}
+	}
+	if len(inSync) == 0 {
 		log.Fatal("nothing to do...")
 	}
 
 	// for each that is in sync
 	var commitMessage = ""
-	for _, status := range s.NeedsNothingList {
+	for _, status := range inSync {
 		// open the repo
 		repo, err := git.PlainOpen(status.Dir)
 		if err != nil {
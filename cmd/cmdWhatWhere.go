@@ -2,16 +2,50 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/plumbing"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-type WhatWhere map[string]Status
+type Where struct {
+	Dir       string        `json:"path" yaml:"path"`
+	Branch    string        `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Commit    string        `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Detached  bool          `json:"detached,omitempty" yaml:"detached,omitempty"`
+	Unborn    bool          `json:"unborn,omitempty" yaml:"unborn,omitempty"`
+	Tags      []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	RemoteURL string        `json:"remote_url,omitempty" yaml:"remote_url,omitempty"`
+	Remotes   []WhereRemote `json:"remotes" yaml:"remotes"`
+	// the last commit on HEAD
+	CommittedAt *time.Time `json:"committed_at,omitempty" yaml:"committed_at,omitempty"`
+	Subject     string     `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Detail      string     `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Error       string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type WhereRemote struct {
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"`
+}
+
+type WhatWhere map[string]Where
+
+// List returns every location sorted by dir
+func (s WhatWhere) List() []Where {
+	list := make([]Where, 0, len(s))
+	for _, where := range s {
+		list = append(list, where)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Dir < list[j].Dir })
+	return list
+}
 
 func CMDWhatWhereInit() {
 	// A general configuration object (feed with flags, conf files, etc.)
@@ -27,70 +61,168 @@ func CMDWhatWhereInit() {
 		},
 	}
 
-	PrvKFilePathFlag(c, v)
-	PrvKPasswordFlag(c, v)
+	DirsFlags(c, v)
+	OutputFlag(c, v)
 	MAIN.AddCommand(c)
 }
 
-func CMDWhatWhere(v *viper.Viper, dirs []string) {
-	publicKeys, err := PubKsGet(v)
+func CMDWhatWhere(v *viper.Viper, args []string) {
+	output, err := OutputGet(v)
+	if err != nil {
+		log.Fatalf("could not get output format: %v", err)
+	}
+
+	dirs, err := DirsGet(v, args)
+	if err != nil {
+		log.Fatalf("could not get repo dirs: %v", err)
+	}
+
+	s := GitWhatWhereGet(dirs)
+	if output == OUTPUT_TEXT {
+		WhatWherePrint(s)
+		return
+	}
+	err = OutputWrite(os.Stdout, output, s.List())
 	if err != nil {
-		log.Fatalf("could not get publicKeys: %v", err)
+		log.Fatalf("could not write whatwhere: %v", err)
 	}
+}
 
-	s := GitWhatWhereGet(publicKeys, dirs)
-	WhatWherePrint(s)
+func GitWhatWhereGet(dirs []string) WhatWhere {
+	s := make(WhatWhere)
+	for _, dir := range dirs {
+		s[dir] = GitWhereGet(dir)
+	}
+	return s
 }
 
-func GitWhatWhereGet(publicKeys *ssh.PublicKeys, dirs []string) WhatWhere {
-	s := make(map[string]Status)
+// GitWhereGet describes what is checked out in dir. HEAD can be a branch, a
+// detached commit or a branch without commits.
+func GitWhereGet(dir string) Where {
+	where := Where{Dir: dir, Remotes: []WhereRemote{}}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		where.Error = err.Error()
+		return where
+	}
 
-	checkErr := func(err error, dir string) bool {
-		if err != nil {
-			s[dir] = Status{Dir: dir, Detail: clrRed + err.Error() + clrReset}
-			return true
+	// every remote, origin is the one in the detail
+	remotes, err := r.Remotes()
+	if err != nil {
+		where.Error = fmt.Sprintf("could not get remotes: %v", err)
+		return where
+	}
+	for _, remote := range remotes {
+		wr := WhereRemote{Name: remote.Config().Name}
+		if len(remote.Config().URLs) > 0 {
+			wr.URL = remote.Config().URLs[0]
+		}
+		if wr.Name == "origin" {
+			where.RemoteURL = wr.URL
 		}
-		return false
+		where.Remotes = append(where.Remotes, wr)
 	}
+	sort.Slice(where.Remotes, func(i, j int) bool { return where.Remotes[i].Name < where.Remotes[j].Name })
 
-	for _, dir := range dirs {
-		// open, get worktree, status, and config
-		r, err := git.PlainOpen(dir)
-		if checkErr(err, dir) {
-			continue
+	// HEAD without resolving, to tell branches from detached commits
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		where.Error = fmt.Sprintf("could not get ref for head %v", err)
+		return where
+	}
+	var hash plumbing.Hash
+	if head.Type() == plumbing.SymbolicReference {
+		where.Branch = head.Target().Short()
+		ref, err := r.Reference(head.Target(), true)
+		if err == plumbing.ErrReferenceNotFound {
+			where.Unborn = true
+		} else if err != nil {
+			where.Error = fmt.Sprintf("could not get %s: %v", where.Branch, err)
+			return where
+		} else {
+			hash = ref.Hash()
 		}
+	} else {
+		where.Detached = true
+		hash = head.Hash()
+	}
 
-		o, err := r.Remote("origin")
+	if !hash.IsZero() {
+		where.Commit = hash.String()[:7]
+		where.Tags, err = TagsAtGet(r, hash)
 		if err != nil {
-			s[dir] = Status{Dir: dir, Detail: fmt.Sprintf(clrRed+"could not get origin %v"+clrReset, err)}
-			continue
+			where.Error = fmt.Sprintf("could not get tags: %v", err)
+			return where
 		}
-		h, err := r.Head()
+		commit, err := r.CommitObject(hash)
 		if err != nil {
-			s[dir] = Status{Dir: dir, Detail: fmt.Sprintf(clrRed+"could not get ref for head %v"+clrReset, err)}
-			continue
+			where.Error = fmt.Sprintf("could not get commit %s: %v", where.Commit, err)
+			return where
 		}
-		s[dir] = Status{Dir: dir, Detail: fmt.Sprintf(clrGreen+"%s of %s"+clrReset, h.Name()[11:], o.Config().URLs[0])}
+		when := commit.Committer.When
+		where.CommittedAt = &when
+		where.Subject = strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0]
 	}
-	return s
-}
 
-func WhatWherePrint(s WhatWhere) {
-	sortedKeys := func(m map[string]Status) []string {
-		keys := make([]string, len(m))
-		i := 0
-		for k := range m {
-			keys[i] = k
-			i++
+	switch {
+	case where.Unborn:
+		where.Detail = "unborn branch " + where.Branch
+	case where.Detached:
+		where.Detail = "detached at " + where.Commit
+		if len(where.Tags) > 0 {
+			where.Detail += " (" + strings.Join(where.Tags, ", ") + ")"
 		}
-		sort.Strings(keys)
-		return keys
+	default:
+		where.Detail = where.Branch
+	}
+	if where.RemoteURL != "" {
+		where.Detail += " of " + where.RemoteURL
+	} else if len(where.Remotes) == 0 {
+		where.Detail += ", no remotes"
+	}
+	return where
+}
+
+// TagsAtGet returns the sorted names of the tags that point at hash, directly
+// or through an annotated tag
+func TagsAtGet(r *git.Repository, hash plumbing.Hash) ([]string, error) {
+	tags := make([]string, 0)
+	iter, err := r.Tags()
+	if err != nil {
+		return nil, err
 	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := r.TagObject(target); err == nil {
+			target = tag.Target
+		}
+		if target == hash {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	})
+	sort.Strings(tags)
+	return tags, err
+}
 
-	var keys []string
-	keys = sortedKeys(s)
-	for _, key := range keys {
-		syncReq := s[key]
-		fmt.Printf("%20s %s\n", syncReq.Dir, syncReq.Detail)
+func WhatWherePrint(s WhatWhere) {
+	for _, where := range s.List() {
+		if where.Error != "" {
+			fmt.Printf("%20s %s\n", where.Dir, clrRed+where.Error+clrReset)
+			continue
+		}
+		clr := clrGreen
+		if where.Detached || where.Unborn {
+			clr = clrYellow
+		}
+		fmt.Printf("%20s %s\n", where.Dir, clr+where.Detail+clrReset)
+		if where.CommittedAt != nil {
+			fmt.Printf("%20s %s %s\n", "", where.CommittedAt.Local().Format("2006-01-02 15:04"), where.Subject)
+		}
+		if len(where.Remotes) > 1 {
+			for _, remote := range where.Remotes {
+				fmt.Printf("%20s %s %s\n", "", fmt.Sprintf("%-8s", remote.Name), remote.URL)
+			}
+		}
 	}
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGitWhereGetDetachedWithTags(t *testing.T) {
+	repos := newLocalClone(t)
+	hash := commitFile(t, repos.work, "a.txt", "a\n", "release prep\n\nbody")
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateTag("v1.0.0", hash, &git.CreateTagOptions{Tagger: &object.Signature{Name: "Test User", Email: "test@example.com"}, Message: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateTag("light", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateRemote(&config.RemoteConfig{Name: "upstream", URLs: []string{"https://example.test/upstream.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	where := GitWhereGet(repos.work)
+	short := hash.String()[:7]
+	if where.Error != "" || !where.Detached || where.Commit != short || where.Subject != "release prep" || where.CommittedAt == nil {
+		t.Fatalf("unexpected where: %#v", where)
+	}
+	if want := "detached at " + short + " (light, v1.0.0) of " + repos.origin; where.Detail != want {
+		t.Fatalf("detail %q, want %q", where.Detail, want)
+	}
+	if len(where.Remotes) != 2 || where.Remotes[0].Name != "origin" || where.Remotes[1].URL != "https://example.test/upstream.git" {
+		t.Fatalf("unexpected remotes: %#v", where.Remotes)
+	}
+}
+
+func TestGitWhereGetUnbornWithoutRemotes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "empty")
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))); err != nil {
+		t.Fatal(err)
+	}
+
+	where := GitWhereGet(dir)
+	if where.Error != "" || !where.Unborn || where.Branch != "main" || where.Detail != "unborn branch main, no remotes" || where.CommittedAt != nil {
+		t.Fatalf("unexpected where: %#v", where)
+	}
+}
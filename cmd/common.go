@@ -1,16 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/google/go-github/v49/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	giturls "github.com/whilp/git-urls"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/sync/errgroup"
 )
 
 var NL = "\n"
@@ -31,18 +43,15 @@ func PubKsGet(v *viper.Viper) (publicKeys *ssh.PublicKeys, err error) {
 		return nil, fmt.Errorf("could not get ssh key path: %v", err)
 	}
 
-	prvKPassword, err := PrvKPasswordGet(v, prvKFilePath)
+	// do not ask for the password of a key that is not there
+	bytes, err := os.ReadFile(prvKFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("could not get ssh key password: %v", err)
+		return nil, fmt.Errorf("read private key %s: %w", prvKFilePath, err)
 	}
 
-	_, err = os.Stat(prvKFilePath)
-	if err != nil {
-		return nil, fmt.Errorf(clrRed + "read file %s failed %s\n" + clrReset)
-	}
-	bytes, err := os.ReadFile(prvKFilePath)
+	prvKPassword, err := PrvKPasswordGet(v, prvKFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("could not read private key file: %v", err)
+		return nil, fmt.Errorf("could not get ssh key password: %v", err)
 	}
 	publicKeys, err = ssh.NewPublicKeys("git", bytes, prvKPassword)
 	if err != nil {
@@ -51,133 +60,540 @@ func PubKsGet(v *viper.Viper) (publicKeys *ssh.PublicKeys, err error) {
 	return publicKeys, nil
 }
 
-func ErrKnownHostsWrap(err error) error {
+// get an auth resolver for fetching, none is needed when not fetching
+func StatiAuthGet(v *viper.Viper, opts StatiOpts) *AuthResolver {
+	if opts.NoFetch {
+		return nil
+	}
+	return AuthResolverNew(v)
+}
+
+// ErrKnownHostsWrap explains the known_hosts errors that HostKeys does not
+// already explain, which come from go-git checking known_hosts itself. url is
+// the remote url, whose host is the one to scan.
+func ErrKnownHostsWrap(err error, url string) error {
 	if err != nil && strings.Contains(err.Error(), "knownhosts") {
-		err = fmt.Errorf("problem with known_hosts entry for 'github.com'. try running `ssh-keyscan github.com >> ~/.ssh/known_hosts` on your cli: %v", err)
+		host := "<host>"
+		if u, uErr := giturls.Parse(url); uErr == nil && u.Host != "" {
+			host = knownhosts.Normalize(u.Host)
+		}
+		err = fmt.Errorf("problem with the known_hosts entry of %s. check it with `%s`: %v", host, KeyscanCommand(host), err)
 	}
 	return err
 }
 
+// StatusClass is the overall classification of a repo
+type StatusClass string
+
+const (
+	ClassError       StatusClass = "error"
+	ClassInProgress  StatusClass = "in_progress"
+	ClassNeedsSync   StatusClass = "needs_sync"
+	ClassNeedsCommit StatusClass = "needs_commit"
+	ClassHasStash    StatusClass = "has_stash"
+	ClassInSync      StatusClass = "in_sync"
+)
+
 type Status struct {
-	Dir    string
-	Detail string
+	Dir       string         `json:"path" yaml:"path"`
+	RemoteURL string         `json:"remote_url,omitempty" yaml:"remote_url,omitempty"`
+	Head      string         `json:"head,omitempty" yaml:"head,omitempty"`
+	Operation Operation      `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Class     StatusClass    `json:"class" yaml:"class"`
+	Detail    string         `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Error     string         `json:"error,omitempty" yaml:"error,omitempty"`
+	Staged    int            `json:"staged" yaml:"staged"`
+	Unstaged  int            `json:"unstaged" yaml:"unstaged"`
+	Untracked int            `json:"untracked" yaml:"untracked"`
+	Stashes   int            `json:"stashes" yaml:"stashes"`
+	Branches  []BranchStatus `json:"branches" yaml:"branches"`
+
+	// set when the remote tracking refs were not fetched by this run
+	Offline   bool       `json:"offline" yaml:"offline"`
+	FetchedAt *time.Time `json:"fetched_at,omitempty" yaml:"fetched_at,omitempty"`
+}
+
+// BranchStatus compares a local branch with its upstream branch
+type BranchStatus struct {
+	Name      string    `json:"name" yaml:"name"`
+	Upstream  string    `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Sync      SyncState `json:"sync" yaml:"sync"`
+	Detail    string    `json:"detail" yaml:"detail"`
+	Ahead     int       `json:"ahead" yaml:"ahead"`
+	Behind    int       `json:"behind" yaml:"behind"`
+	MergeBase string    `json:"merge_base,omitempty" yaml:"merge_base,omitempty"`
 }
 
 type Stati struct {
+	InProgressList   map[string]Status
 	NeedsSyncList    map[string]Status
 	NeedsCommitList  map[string]Status
+	HasStashList     map[string]Status
 	RepoErrorList    map[string]Status
 	NeedsNothingList map[string]Status
+
+	mu sync.Mutex
 }
 
-func GitStatiGet(publicKeys *ssh.PublicKeys, dirs []string) *Stati {
-	s := &Stati{
+func StatiNew() *Stati {
+	return &Stati{
+		InProgressList:   make(map[string]Status),
 		NeedsSyncList:    make(map[string]Status),
 		NeedsCommitList:  make(map[string]Status),
+		HasStashList:     make(map[string]Status),
 		RepoErrorList:    make(map[string]Status),
 		NeedsNothingList: make(map[string]Status),
 	}
+}
 
-	checkErr := func(err error, dir string) bool {
-		if err != nil {
-			err = ErrKnownHostsWrap(err)
-			s.RepoErrorList[dir] = Status{Dir: dir, Detail: err.Error()}
-			return true
-		}
-		return false
+// Put records a status in the list for its class. Safe for concurrent use.
+func (s *Stati) Put(status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch status.Class {
+	case ClassError:
+		s.RepoErrorList[status.Dir] = status
+	case ClassInProgress:
+		s.InProgressList[status.Dir] = status
+	case ClassNeedsSync:
+		s.NeedsSyncList[status.Dir] = status
+	case ClassNeedsCommit:
+		s.NeedsCommitList[status.Dir] = status
+	case ClassHasStash:
+		s.HasStashList[status.Dir] = status
+	default:
+		s.NeedsNothingList[status.Dir] = status
 	}
+}
 
-REPOS:
-	for _, dir := range dirs {
-		// open, get worktree, status, and config
-		r, err := git.PlainOpen(dir)
-		if checkErr(err, dir) {
-			continue
+// List returns every status sorted by dir
+func (s *Stati) List() []Status {
+	list := make([]Status, 0)
+	for _, m := range []map[string]Status{s.RepoErrorList, s.InProgressList, s.NeedsSyncList, s.NeedsCommitList, s.HasStashList, s.NeedsNothingList} {
+		for _, status := range m {
+			list = append(list, status)
 		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Dir < list[j].Dir })
+	return list
+}
 
-		// fetch the origin
-		fmt.Printf(clrYellow + " fetching " + dir + " origin" + NL)
-		err = r.Fetch(&git.FetchOptions{RemoteName: "origin", Auth: publicKeys, InsecureSkipTLS: true})
-		if err != nil {
-			if strings.Contains(err.Error(), "already up-to-date") {
-				// do nothing
-			} else if strings.Contains(err.Error(), "knownhosts") {
-				err = fmt.Errorf("problem with known_hosts entry for 'github.com'. try running `ssh-keyscan github.com >> ~/.ssh/known_hosts` on your cli: %v", err)
-				s.RepoErrorList[dir] = Status{Dir: dir, Detail: err.Error()}
-				continue
-			}
-		}
+type StatiOpts struct {
+	Jobs         int
+	FetchTimeout time.Duration
+	NoFetch      bool
+}
 
-		// remoteOriginURL := origin.URLs[0]
+func StatiOptsFlags(c *cobra.Command, v *viper.Viper) {
+	JobsFlag(c, v)
+	FetchTimeoutFlag(c, v)
+	NoFetchFlag(c, v)
+}
 
-		// get references for head and remote/origin
-		refs, err := r.References()
-		if checkErr(err, dir) {
-			continue
-		}
-		refsHeads := make(map[string]string)
-		refsOrigin := make(map[string]string)
-		err = refs.ForEach(func(ref *plumbing.Reference) error {
-			// The HEAD is omitted in a `git show-ref` so we ignore the symbolic
-			// references, the HEAD
-			if ref.Type() == plumbing.SymbolicReference {
+func StatiOptsGet(v *viper.Viper) StatiOpts {
+	return StatiOpts{
+		Jobs:         JobsGet(v),
+		FetchTimeout: FetchTimeoutGet(v),
+		NoFetch:      NoFetchGet(v),
+	}
+}
+
+// InterruptCtxGet returns a context that is cancelled on Ctrl-C
+func InterruptCtxGet() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func GitStatiGet(ctx context.Context, auth *AuthResolver, dirs []string, opts StatiOpts) *Stati {
+	s := StatiNew()
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	eg := new(errgroup.Group)
+	eg.SetLimit(jobs)
+	for _, dir := range dirs {
+		dir := dir
+		eg.Go(func() error {
+			// skip repos that never started before a cancel
+			if err := ctx.Err(); err != nil {
+				s.Put(Status{Dir: dir, Class: ClassError, Error: err.Error()})
 				return nil
 			}
-			if strings.HasPrefix(string(ref.Name()), "refs/heads/") {
-				refsHeads[string(ref.Name()[11:])] = ref.Hash().String()
+			s.Put(GitStatusGet(ctx, auth, dir, opts))
+			return nil
+		})
+	}
+	eg.Wait()
+	return s
+}
+
+func GitStatusGet(ctx context.Context, auth *AuthResolver, dir string, opts StatiOpts) Status {
+	status := Status{Dir: dir, Branches: []BranchStatus{}}
+	errStatus := func(err error) Status {
+		status.Class = ClassError
+		status.Error = err.Error()
+		return status
+	}
+
+	// open, get worktree, status, and config
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return errStatus(err)
+	}
+	if origin, err := r.Remote("origin"); err == nil && len(origin.Config().URLs) > 0 {
+		status.RemoteURL = origin.Config().URLs[0]
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return errStatus(err)
+	}
+
+	// fetch every remote that a branch tracks
+	if opts.NoFetch {
+		status.Offline = true
+	} else {
+		remotes := UpstreamRemotesGet(cfg)
+		for _, remote := range remotes {
+			err = GitFetch(ctx, r, remote, auth, dir, opts)
+			if err != nil {
+				return errStatus(err)
 			}
-			if strings.HasPrefix(string(ref.Name()), "refs/remotes/origin/") {
-				refsOrigin[string(ref.Name()[20:])] = ref.Hash().String()
+		}
+		if len(remotes) > 0 {
+			if err = FetchedTouch(r); err != nil {
+				return errStatus(err)
 			}
+		}
+	}
+	status.FetchedAt = FetchTimeGet(r)
+
+	// a merge, rebase, etc. that is not finished
+	status.Operation = OperationGet(r)
 
+	// get the checked out branch
+	if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+		status.Head = head.Name().Short()
+	}
+
+	// get references for heads
+	refs, err := r.References()
+	if err != nil {
+		return errStatus(err)
+	}
+	refsHeads := make(map[string]plumbing.Hash)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		// The HEAD is omitted in a `git show-ref` so we ignore the symbolic
+		// references, the HEAD
+		if ref.Type() == plumbing.SymbolicReference {
 			return nil
-		})
-		if checkErr(err, dir) {
+		}
+		if ref.Name().IsBranch() {
+			refsHeads[ref.Name().Short()] = ref.Hash()
+		}
+		return nil
+	})
+	if err != nil {
+		return errStatus(err)
+	}
+
+	// compare every head branch with its upstream branch
+	headBranches := make([]string, 0, len(refsHeads))
+	for headBranch := range refsHeads {
+		headBranches = append(headBranches, headBranch)
+	}
+	sort.Strings(headBranches)
+
+	needsSync := 0
+	for _, headBranch := range headBranches {
+		headHash := refsHeads[headBranch]
+		b := BranchStatus{Name: headBranch}
+		upstream, ok := UpstreamGet(cfg, headBranch)
+		if !ok {
+			b.Sync = SyncNoUpstream
+			b.Detail = SyncDetail(b.Sync, "")
+			status.Branches = append(status.Branches, b)
 			continue
 		}
+		b.Upstream = upstream.String()
 
-		// for each head reference
-		for headBranch, headHash := range refsHeads {
-			originHash, ok := refsOrigin[headBranch]
-			if !ok {
-				s.NeedsSyncList[dir] = Status{Dir: dir + " " + headBranch, Detail: clrYellow + "has no origin branch" + clrReset}
-				continue REPOS
+		upstreamRef, err := r.Reference(upstream.RefName(cfg), true)
+		if err == plumbing.ErrReferenceNotFound {
+			// a configured upstream without a remote branch is gone
+			b.Sync = SyncGone
+		} else if err != nil {
+			return errStatus(err)
+		} else if headHash == upstreamRef.Hash() {
+			b.Sync = SyncInSync
+			b.MergeBase = headHash.String()
+		} else {
+			ab, err := AheadBehindGet(r, headHash, upstreamRef.Hash())
+			if err != nil {
+				return errStatus(err)
 			}
-
-			if headHash != originHash {
-				s.NeedsSyncList[dir] = Status{Dir: dir + " " + headBranch, Detail: clrYellow + "out of sync with origin" + clrReset}
-				continue REPOS
+			b.Sync = ab.State()
+			b.Ahead = ab.Ahead
+			b.Behind = ab.Behind
+			// unrelated histories have no merge base
+			if !ab.MergeBase.IsZero() {
+				b.MergeBase = ab.MergeBase.String()
 			}
 		}
-
-		// now get the current worktree
-		w, err := r.Worktree()
-		if checkErr(err, dir) {
-			continue
+		b.Detail = SyncDetail(b.Sync, b.Upstream)
+		if b.Sync != SyncInSync {
+			needsSync++
 		}
+		status.Branches = append(status.Branches, b)
+	}
 
-		// loop through all status
+	// now get the current worktree and count the changes. bare repos have none.
+	w, err := r.Worktree()
+	if err != nil && err != git.ErrIsBareRepository {
+		return errStatus(err)
+	}
+	if w != nil {
 		stati, err := w.Status()
-		if checkErr(err, dir) {
-			continue
+		if err != nil {
+			return errStatus(err)
 		}
-		for _, status := range stati {
-			if status.Worktree != git.Unmodified {
-				s.NeedsCommitList[dir] = Status{Dir: dir, Detail: clrPurple + "has unstaged changes" + clrReset}
-				continue REPOS
+		for _, fs := range stati {
+			if fs.Worktree == git.Untracked {
+				status.Untracked++
+				continue
+			}
+			if fs.Worktree != git.Unmodified {
+				status.Unstaged++
 			}
-			if status.Staging != git.Unmodified {
-				s.NeedsCommitList[dir] = Status{Dir: dir, Detail: clrPurple + "has staged changes" + clrReset}
-				continue REPOS
+			if fs.Staging != git.Unmodified {
+				status.Staged++
 			}
 		}
+	}
 
-		s.NeedsNothingList[dir] = Status{Dir: dir, Detail: clrGreen + "in sync" + clrReset}
+	// count the stashes, which can hide work in an otherwise clean repo
+	status.Stashes, err = StashCountGet(r)
+	if err != nil {
+		return errStatus(err)
 	}
-	return s
+
+	switch {
+	case status.Operation != "":
+		status.Class = ClassInProgress
+		status.Detail = status.Operation.Detail()
+	case needsSync > 0:
+		status.Class = ClassNeedsSync
+		status.Detail = fmt.Sprintf("%d of %d branches out of sync", needsSync, len(status.Branches))
+	case status.Unstaged > 0 || status.Untracked > 0:
+		status.Class = ClassNeedsCommit
+		status.Detail = "has unstaged changes"
+	case status.Staged > 0:
+		status.Class = ClassNeedsCommit
+		status.Detail = "has staged changes"
+	case status.Stashes > 0:
+		status.Class = ClassHasStash
+		status.Detail = fmt.Sprintf("has %d stashes", status.Stashes)
+	default:
+		status.Class = ClassInSync
+		status.Detail = "in sync"
+	}
+	return status
+}
+
+// states that select repos, beyond the status classes and branch sync states
+const (
+	StateDirty = "dirty"
+	StateClean = "clean"
+)
+
+func StatusStateValid(state string) bool {
+	switch state {
+	case StateDirty, StateClean,
+		string(ClassError), string(ClassInProgress), string(ClassNeedsSync), string(ClassNeedsCommit), string(ClassHasStash), string(ClassInSync),
+		string(SyncAhead), string(SyncBehind), string(SyncDiverged), string(SyncGone), string(SyncNoUpstream):
+		return true
+	}
+	return Operation(state).Valid()
+}
+
+// StatusIs is true when the status is in all the states. Sync states match
+// when any branch is in them.
+func StatusIs(status Status, states ...string) bool {
+	for _, state := range states {
+		if !statusIs(status, state) {
+			return false
+		}
+	}
+	return true
+}
+
+func statusIs(status Status, state string) bool {
+	dirty := status.Staged+status.Unstaged+status.Untracked > 0
+	switch state {
+	case StateDirty:
+		return status.Class != ClassError && dirty
+	case StateClean:
+		return status.Class != ClassError && !dirty
+	case string(ClassError), string(ClassInProgress), string(ClassNeedsSync), string(ClassNeedsCommit), string(ClassHasStash), string(ClassInSync):
+		return string(status.Class) == state
+	}
+	if Operation(state).Valid() {
+		return status.Operation == Operation(state)
+	}
+	for _, b := range status.Branches {
+		if string(b.Sync) == state {
+			return true
+		}
+	}
+	return false
+}
+
+func SyncDetail(state SyncState, upstream string) string {
+	switch state {
+	case SyncAhead:
+		return "ahead of " + upstream
+	case SyncBehind:
+		return "behind " + upstream
+	case SyncDiverged:
+		return "diverged from " + upstream
+	case SyncNoUpstream:
+		return "no upstream"
+	case SyncGone:
+		return upstream + " is gone"
+	}
+	return "in sync"
+}
+
+// GitFetch fetches one remote, treating up-to-date as success
+func GitFetch(ctx context.Context, r *git.Repository, remote string, auth *AuthResolver, dir string, opts StatiOpts) error {
+	fmt.Fprintf(os.Stderr, clrYellow+" fetching "+dir+" "+remote+clrReset+NL)
+	fetchCtx := ctx
+	if opts.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = auth.TimeoutCtx(ctx, opts.FetchTimeout)
+		defer cancel()
+	}
+	url, err := RemoteURLGet(r, remote)
+	if err != nil {
+		return err
+	}
+	fetchAuth, err := auth.Get(url)
+	if err != nil {
+		return err
+	}
+	fetchOpts := &git.FetchOptions{RemoteName: remote, Auth: fetchAuth, InsecureSkipTLS: auth.InsecureSkipTLS(url)}
+	err = r.FetchContext(fetchCtx, fetchOpts)
+	if err != nil {
+		if err == git.NoErrAlreadyUpToDate {
+			// do nothing
+		} else if strings.Contains(err.Error(), "knownhosts") {
+			return ErrKnownHostsWrap(err, url)
+		} else if fetchCtx.Err() != nil && ctx.Err() == nil {
+			return fmt.Errorf("could not fetch %s: timed out after %s", remote, opts.FetchTimeout)
+		} else if ctx.Err() != nil {
+			return fmt.Errorf("could not fetch %s: %v", remote, ctx.Err())
+		} else {
+			return fmt.Errorf("could not fetch %s: %v", remote, err)
+		}
+	}
+	return nil
+}
+
+// FETCHED_FILE records when gitall last fetched a repo. go-git does not write
+// FETCH_HEAD and that file belongs to git, so gitall keeps its own.
+const FETCHED_FILE = "gitall-fetched"
+
+// FetchedTouch bumps the mtime of FETCHED_FILE after a fetch to keep the
+// staleness of the remote tracking refs visible to --no-fetch runs
+func FetchedTouch(r *git.Repository) error {
+	storage, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+	fs := storage.Filesystem()
+	now := time.Now()
+	err := os.Chtimes(fs.Join(fs.Root(), FETCHED_FILE), now, now)
+	if os.IsNotExist(err) {
+		f, err := fs.Create(FETCHED_FILE)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %v", FETCHED_FILE, err)
+		}
+		return f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("could not touch %s: %v", FETCHED_FILE, err)
+	}
+	return nil
+}
+
+// FetchTimeGet returns the time of the last fetch by gitall or git, whichever
+// is newer, or nil if never fetched
+func FetchTimeGet(r *git.Repository) *time.Time {
+	storage, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+	var fetched *time.Time
+	for _, name := range []string{FETCHED_FILE, "FETCH_HEAD"} {
+		fi, err := storage.Filesystem().Stat(name)
+		if err != nil {
+			continue
+		}
+		if t := fi.ModTime(); fetched == nil || t.After(*fetched) {
+			fetched = &t
+		}
+	}
+	return fetched
+}
+
+// AgeText renders a duration as a coarse age like `3h`
+func AgeText(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+// StaleText describes the age of the remote tracking refs for offline runs
+func StaleText(status Status) string {
+	if !status.Offline {
+		return ""
+	}
+	if status.FetchedAt == nil {
+		return " (never fetched)"
+	}
+	return " (fetched " + AgeText(time.Since(*status.FetchedAt)) + ")"
+}
+
+// StashText notes the stashes of a repo whose class does not mention them
+func StashText(status Status) string {
+	if status.Stashes == 0 || status.Class == ClassHasStash {
+		return ""
+	}
+	return fmt.Sprintf(", has %d stashes", status.Stashes)
+}
+
+// AheadBehindText renders counts as `↑3 ↓1`
+func AheadBehindText(b BranchStatus) string {
+	if b.Ahead == 0 && b.Behind == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\u2191%d \u2193%d", b.Ahead, b.Behind)
 }
 
 func StatiPrint(s *Stati) {
+	StatiWrite(os.Stdout, s)
+}
+
+// StatiWrite writes the status of each repo as a line of text. Repos that need
+// sync list every branch, other repos only the branches without an upstream.
+func StatiWrite(w io.Writer, s *Stati) {
 	sortedKeys := func(m map[string]Status) []string {
 		keys := make([]string, len(m))
 		i := 0
@@ -193,42 +609,70 @@ func StatiPrint(s *Stati) {
 	keys = sortedKeys(s.RepoErrorList)
 	for _, key := range keys {
 		syncReq := s.RepoErrorList[key]
-		fmt.Printf(clrRed + " x  " + clrReset + fmt.Sprintf("%-40s", syncReq.Dir) + " " + syncReq.Detail + NL)
+		fmt.Fprintf(w, clrRed+" x  "+clrReset+fmt.Sprintf("%-40s", syncReq.Dir)+" "+syncReq.Error+NL)
 	}
 
 	keys = sortedKeys(s.NeedsNothingList)
 	for _, key := range keys {
 		syncReq := s.NeedsNothingList[key]
-		fmt.Printf(clrGreen + " \u2714 " + clrReset + " " + fmt.Sprintf("%-40s", syncReq.Dir) + " " + syncReq.Detail + NL)
+		fmt.Fprintf(w, clrGreen+" \u2714 "+clrReset+" "+fmt.Sprintf("%-40s", syncReq.Dir)+" "+clrGreen+syncReq.Detail+StashText(syncReq)+clrReset+StaleText(syncReq)+NL)
+		BranchesWrite(w, syncReq, false)
 	}
 
 	keys = sortedKeys(s.NeedsCommitList)
 	for _, key := range keys {
 		syncReq := s.NeedsCommitList[key]
-		fmt.Printf(clrPurple + " +  " + clrReset + fmt.Sprintf("%-40s", syncReq.Dir) + " " + syncReq.Detail + NL)
+		fmt.Fprintf(w, clrPurple+" +  "+clrReset+fmt.Sprintf("%-40s", syncReq.Dir)+" "+clrPurple+syncReq.Detail+StashText(syncReq)+clrReset+StaleText(syncReq)+NL)
+		BranchesWrite(w, syncReq, false)
+	}
+
+	keys = sortedKeys(s.HasStashList)
+	for _, key := range keys {
+		syncReq := s.HasStashList[key]
+		fmt.Fprintf(w, clrPurple+" s  "+clrReset+fmt.Sprintf("%-40s", syncReq.Dir)+" "+clrPurple+syncReq.Detail+clrReset+StaleText(syncReq)+NL)
+		BranchesWrite(w, syncReq, false)
+	}
+
+	keys = sortedKeys(s.InProgressList)
+	for _, key := range keys {
+		syncReq := s.InProgressList[key]
+		fmt.Fprintf(w, clrRed+" !  "+clrReset+fmt.Sprintf("%-40s", syncReq.Dir)+" "+clrRed+syncReq.Detail+StashText(syncReq)+clrReset+StaleText(syncReq)+NL)
+		BranchesWrite(w, syncReq, false)
 	}
 
 	keys = sortedKeys(s.NeedsSyncList)
 	for _, key := range keys {
 		syncReq := s.NeedsSyncList[key]
-		fmt.Printf(clrYellow + "<-> " + clrReset + fmt.Sprintf("%-40s", syncReq.Dir) + " " + syncReq.Detail + NL)
+		fmt.Fprintf(w, clrYellow+"<-> "+clrReset+fmt.Sprintf("%-40s", syncReq.Dir)+" "+clrYellow+syncReq.Detail+StashText(syncReq)+clrReset+StaleText(syncReq)+NL)
+		BranchesWrite(w, syncReq, true)
 	}
 }
 
-func GithubClientGet(v *viper.Viper) (*github.Client, error) {
-	// eventually use this... https://github.com/cli/cli/blob/v2.21.2/internal/authflow/flow.go#L37
-	githubUser, err := GitHubUserGet(v)
-	if err != nil {
-		return nil, fmt.Errorf("could not get github.com username: %v", err)
+// BranchesWrite writes a line per branch of a repo, or with all unset, only
+// the branches that have no upstream or whose upstream is gone
+func BranchesWrite(w io.Writer, status Status, all bool) {
+	for _, b := range status.Branches {
+		if !all && b.Sync != SyncNoUpstream && b.Sync != SyncGone {
+			continue
+		}
+		clr := clrYellow
+		if b.Sync == SyncInSync {
+			clr = clrGreen
+		}
+		fmt.Fprintf(w, "      "+fmt.Sprintf("%-38s", b.Name)+" "+fmt.Sprintf("%-8s", AheadBehindText(b))+" "+clr+b.Detail+clrReset+NL)
 	}
-	githubPass, err := GitHubPassGet(v)
+}
+
+// GithubClientGet returns a client with the github.com token of `auth login`
+// or the env vars
+func GithubClientGet() (*github.Client, error) {
+	ring, err := KeyringOpen()
 	if err != nil {
-		return nil, fmt.Errorf("could not get github.com password: %v", err)
+		log.Debugf("could not access keyring: %v", err)
 	}
-	tp := github.BasicAuthTransport{
-		Username: strings.TrimSpace(githubUser),
-		Password: strings.TrimSpace(githubPass),
+	token, _ := TokenLookup(ring, GITHUB_HOST)
+	if token == "" {
+		return nil, fmt.Errorf("not logged in to %s. run `gitall auth login` or set %s", GITHUB_HOST, TokenEnvGet(GITHUB_HOST))
 	}
-	client := github.NewClient(tp.Client())
-	return client, nil
+	return GithubClientNew(token), nil
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,6 +10,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
@@ -15,7 +18,7 @@ import (
 func TestGitStatiGetClassifiesRepos(t *testing.T) {
 	repos := newLocalClone(t)
 
-	clean := GitStatiGet(nil, []string{repos.work})
+	clean := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
 	if _, ok := clean.NeedsNothingList[repos.work]; !ok {
 		t.Fatalf("clean repo should need nothing: %#v", clean)
 	}
@@ -23,7 +26,7 @@ func TestGitStatiGetClassifiesRepos(t *testing.T) {
 	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("dirty\n"), 0644); err != nil {
 		t.Fatal(err)
 	}
-	dirty := GitStatiGet(nil, []string{repos.work})
+	dirty := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
 	if _, ok := dirty.NeedsCommitList[repos.work]; !ok {
 		t.Fatalf("dirty repo should need commit: %#v", dirty)
 	}
@@ -33,22 +36,155 @@ func TestGitStatiGetClassifiesRepos(t *testing.T) {
 
 	repos = newLocalClone(t)
 	commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
-	outOfSync := GitStatiGet(nil, []string{repos.work})
+	outOfSync := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
 	if _, ok := outOfSync.NeedsSyncList[repos.work]; !ok {
 		t.Fatalf("repo behind origin should need sync: %#v", outOfSync)
 	}
 
 	missing := filepath.Join(t.TempDir(), "missing")
-	errors := GitStatiGet(nil, []string{missing})
+	errors := GitStatiGet(context.Background(), nil, []string{missing}, StatiOpts{})
 	if _, ok := errors.RepoErrorList[missing]; !ok {
 		t.Fatalf("missing repo should be reported as repo error: %#v", errors)
 	}
 }
 
+func TestGitStatiGetReportsEveryBranch(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.work, "a.txt", "a\n", "local 1")
+
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"feature", "gone"} {
+		ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), head.Hash())
+		if err := r.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.CreateBranch(&config.Branch{Name: "gone", Remote: "origin", Merge: "refs/heads/gone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status, ok := s.NeedsSyncList[repos.work]
+	if !ok {
+		t.Fatalf("repo should need sync: %#v", s)
+	}
+	got := map[string]SyncState{}
+	for _, b := range status.Branches {
+		got[b.Name] = b.Sync
+	}
+	want := map[string]SyncState{"feature": SyncNoUpstream, "gone": SyncGone, "master": SyncAhead}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected branches: %#v", status.Branches)
+	}
+	for name, state := range want {
+		if got[name] != state {
+			t.Fatalf("branch %s: got %q want %q", name, got[name], state)
+		}
+	}
+	if status.Branches[0].Name != "feature" || status.Branches[2].Name != "master" {
+		t.Fatalf("branches should be sorted: %#v", status.Branches)
+	}
+}
+
+func TestGitStatiGetNoFetchReportsStaleness(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
+
+	offline := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{NoFetch: true})
+	status, ok := offline.NeedsNothingList[repos.work]
+	if !ok {
+		t.Fatalf("unfetched repo should still match its stale tracking refs: %#v", offline)
+	}
+	if !status.Offline || status.FetchedAt != nil || StaleText(status) != " (never fetched)" {
+		t.Fatalf("unexpected staleness: %#v", status)
+	}
+
+	online := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	if _, ok := online.NeedsSyncList[repos.work]; !ok {
+		t.Fatalf("fetched repo should need sync: %#v", online)
+	}
+	if _, err := os.Stat(filepath.Join(repos.work, ".git", FETCHED_FILE)); err != nil {
+		t.Fatalf("expected the fetch time to be recorded: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repos.work, ".git", "FETCH_HEAD")); !os.IsNotExist(err) {
+		t.Fatalf("expected git's FETCH_HEAD to be left alone: %v", err)
+	}
+
+	offline = GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{NoFetch: true})
+	status = offline.NeedsSyncList[repos.work]
+	if status.FetchedAt == nil || time.Since(*status.FetchedAt) > time.Minute {
+		t.Fatalf("expected a recent fetch time: %#v", status)
+	}
+	if StaleText(status) != " (fetched just now)" {
+		t.Fatalf("unexpected stale text: %q", StaleText(status))
+	}
+}
+
+func TestGitStatiGetBareRepo(t *testing.T) {
+	repos := newLocalClone(t)
+
+	bare := filepath.Join(t.TempDir(), "bare.git")
+	if _, err := git.PlainClone(bare, true, &git.CloneOptions{URL: repos.origin}); err != nil {
+		t.Fatal(err)
+	}
+	s := GitStatiGet(context.Background(), nil, []string{bare}, StatiOpts{})
+	if _, ok := s.NeedsNothingList[bare]; !ok {
+		t.Fatalf("bare repo should be in sync: %#v", s)
+	}
+}
+
+func TestAgeText(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		10 * time.Second: "just now",
+		5 * time.Minute:  "5m ago",
+		3 * time.Hour:    "3h ago",
+		72 * time.Hour:   "3d ago",
+	} {
+		if got := AgeText(d); got != want {
+			t.Fatalf("AgeText(%s): got %q want %q", d, got, want)
+		}
+	}
+}
+
+func TestGitStatiGetParallelJobs(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 6; i++ {
+		dirs = append(dirs, newLocalClone(t).work)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	dirs = append(dirs, missing)
+
+	s := GitStatiGet(context.Background(), nil, dirs, StatiOpts{Jobs: 4})
+	if len(s.NeedsNothingList) != 6 {
+		t.Fatalf("expected 6 clean repos: %#v", s.NeedsNothingList)
+	}
+	if _, ok := s.RepoErrorList[missing]; !ok {
+		t.Fatalf("missing repo should be reported as repo error: %#v", s.RepoErrorList)
+	}
+}
+
+func TestGitStatiGetCancelled(t *testing.T) {
+	repos := newLocalClone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := GitStatiGet(ctx, nil, []string{repos.work}, StatiOpts{Jobs: 2})
+	if _, ok := s.RepoErrorList[repos.work]; !ok {
+		t.Fatalf("cancelled run should report repo error: %#v", s)
+	}
+}
+
 func TestGitWhatWhereGetReportsBranchAndOrigin(t *testing.T) {
 	repos := newLocalClone(t)
 
-	result := GitWhatWhereGet(nil, []string{repos.work})
+	result := GitWhatWhereGet([]string{repos.work})
 	status, ok := result[repos.work]
 	if !ok {
 		t.Fatalf("expected whatwhere result for repo: %#v", result)
@@ -116,3 +252,29 @@ func commitFile(t *testing.T, repoPath, name, content, message string) plumbing.
 	}
 	return hash
 }
+
+func TestStatiWriteListsBranchesWithoutUpstream(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName("topic"), headHash(t, repos.work))
+	if err := r.Storer.SetReference(ref); err != nil {
+		t.Fatal(err)
+	}
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{NoFetch: true})
+	if _, ok := s.NeedsNothingList[repos.work]; !ok {
+		t.Fatalf("a local only branch does not need sync: %#v", s)
+	}
+	var out bytes.Buffer
+	StatiWrite(&out, s)
+	lines := strings.Split(strings.TrimSpace(out.String()), NL)
+	if len(lines) != 2 || !strings.Contains(lines[1], "topic") || !strings.Contains(lines[1], "no upstream") {
+		t.Fatalf("expected the branch without upstream under the repo, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "master") {
+		t.Fatalf("expected only the branch without upstream, got %q", out.String())
+	}
+}
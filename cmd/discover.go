@@ -0,0 +1,217 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const RECURSIVE = "recursive"
+
+func RecursiveFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().BoolP(RECURSIVE, "r", false, "discover repos under the given dirs")
+	v.BindPFlag(RECURSIVE, c.PersistentFlags().Lookup(RECURSIVE))
+}
+
+const MAX_DEPTH = "max-depth"
+
+func MaxDepthFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Int(MAX_DEPTH, 0, "max depth of recursive discovery (0 for no limit)")
+	v.BindPFlag(MAX_DEPTH, c.PersistentFlags().Lookup(MAX_DEPTH))
+}
+
+const NESTED = "nested"
+
+func NestedFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(NESTED, false, "discover repos nested inside other repos")
+	v.BindPFlag(NESTED, c.PersistentFlags().Lookup(NESTED))
+}
+
+const IGNORE = "ignore"
+
+func IgnoreFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(IGNORE, []string{"node_modules"}, "glob patterns of dirs to skip during discovery")
+	v.BindPFlag(IGNORE, c.PersistentFlags().Lookup(IGNORE))
+}
+
+type DiscoverOpts struct {
+	Recursive bool
+	MaxDepth  int
+	Nested    bool
+	Ignore    []string
+}
+
+func DiscoverOptsFlags(c *cobra.Command, v *viper.Viper) {
+	RecursiveFlag(c, v)
+	MaxDepthFlag(c, v)
+	NestedFlag(c, v)
+	IgnoreFlag(c, v)
+}
+
+func DiscoverOptsGet(v *viper.Viper) DiscoverOpts {
+	return DiscoverOpts{
+		Recursive: v.GetBool(RECURSIVE),
+		MaxDepth:  v.GetInt(MAX_DEPTH),
+		Nested:    v.GetBool(NESTED),
+		Ignore:    v.GetStringSlice(IGNORE),
+	}
+}
+
+// DirsFlags registers the flags that select repo dirs
+func DirsFlags(c *cobra.Command, v *viper.Viper) {
+	DiscoverOptsFlags(c, v)
+	ManifestFlag(c, v)
+}
+
+// DirsGet maps command args to repo dirs. `@group` args select repos of the
+// workspace manifest. Without args every repo of the manifest is selected.
+func DirsGet(v *viper.Viper, args []string) ([]string, error) {
+	var selectors, roots []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") {
+			selectors = append(selectors, arg)
+		} else {
+			roots = append(roots, arg)
+		}
+	}
+	if len(args) == 0 && v.GetString(MANIFEST) == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ManifestFind(cwd); err != nil {
+			return nil, nil
+		}
+	}
+	if len(args) == 0 {
+		selectors = []string{"@" + GROUP_ALL}
+	}
+
+	dirs := roots
+	if opts := DiscoverOptsGet(v); opts.Recursive && len(roots) > 0 {
+		var err error
+		dirs, err = ReposDiscover(roots, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(selectors) > 0 {
+		m, err := ManifestGet(v)
+		if err != nil {
+			return nil, err
+		}
+		manifestDirs, err := ManifestDirsGet(m, selectors)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, manifestDirs...)
+	}
+	return dirs, nil
+}
+
+// RepoDirIs is true for worktrees (.git dir or gitfile) and bare repos
+func RepoDirIs(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ReposDiscover walks the roots and returns the sorted repo dirs under them.
+// Symlinked dirs are followed once; a dir reached twice is skipped.
+func ReposDiscover(roots []string, opts DiscoverOpts) ([]string, error) {
+	visited := make(map[string]bool)
+	found := make(map[string]bool)
+
+	ignored := func(root, dir string) bool {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			rel = dir
+		}
+		for _, pattern := range opts.Ignore {
+			if ok, _ := filepath.Match(pattern, filepath.Base(dir)); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var walk func(root, dir string, depth int)
+	walk = func(root, dir string, depth int) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			log.Warnf("could not resolve %s: %v", dir, err)
+			return
+		}
+		if visited[real] {
+			return
+		}
+		visited[real] = true
+
+		if RepoDirIs(dir) {
+			found[dir] = true
+			if !opts.Nested {
+				return
+			}
+		}
+		if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			return
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Warnf("could not read %s: %v", dir, err)
+			return
+		}
+		for _, entry := range entries {
+			if entry.Name() == ".git" {
+				continue
+			}
+			child := filepath.Join(dir, entry.Name())
+			if entry.Type()&os.ModeSymlink != 0 {
+				fi, err := os.Stat(child)
+				if err != nil || !fi.IsDir() {
+					continue
+				}
+			} else if !entry.IsDir() {
+				continue
+			}
+			if ignored(root, child) {
+				continue
+			}
+			walk(root, child, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		fi, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		walk(root, filepath.Clean(root), 0)
+	}
+
+	dirs := make([]string, 0, len(found))
+	for dir := range found {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestReposDiscoverFindsNestedLayouts(t *testing.T) {
+	root := t.TempDir()
+	plainInit := func(rel string, bare bool) string {
+		t.Helper()
+		dir := filepath.Join(root, rel)
+		if _, err := git.PlainInit(dir, bare); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	a := plainInit("a", false)
+	nested := plainInit("a/sub/nested", false)
+	deep := plainInit("org/team/deep", false)
+	bare := plainInit("org/bare.git", true)
+	plainInit("node_modules/dep", false)
+
+	// a linked worktree has a gitfile instead of a .git dir
+	wt := filepath.Join(root, "org", "wt")
+	if err := os.MkdirAll(wt, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt, ".git"), []byte("gitdir: "+filepath.Join(a, ".git")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a symlink back to the root must not loop
+	if err := os.Symlink(root, filepath.Join(root, "org", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReposDiscover([]string{root}, DiscoverOpts{Ignore: []string{"node_modules"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{a, bare, deep, wt}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected repos:\n got %v\nwant %v", got, want)
+	}
+
+	got, err = ReposDiscover([]string{root}, DiscoverOpts{Nested: true, Ignore: []string{"node_modules"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{a, nested, bare, deep, wt}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected nested repos:\n got %v\nwant %v", got, want)
+	}
+
+	got, err = ReposDiscover([]string{root}, DiscoverOpts{MaxDepth: 2, Ignore: []string{"node_modules"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{a, bare, wt}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected depth limited repos:\n got %v\nwant %v", got, want)
+	}
+}
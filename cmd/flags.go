@@ -3,9 +3,12 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	keyring "github.com/99designs/keyring"
 	log "github.com/sirupsen/logrus"
@@ -14,21 +17,141 @@ import (
 	"golang.org/x/term"
 )
 
+// GLOBAL holds the settings of every command, from the flags on MAIN or the
+// GITALL_ env vars, eg GITALL_KEYRING_BACKEND or GITALL_NON_INTERACTIVE
+var GLOBAL = viper.New()
+
+func GlobalFlags(c *cobra.Command, v *viper.Viper) {
+	KeyringBackendFlag(c, v)
+	KeyringDirFlag(c, v)
+	NonInteractiveFlag(c, v)
+	v.SetEnvPrefix("gitall")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+}
+
+const KEYRING_BACKEND = "keyring-backend"
+
+var keyringBackends = []keyring.BackendType{
+	keyring.FileBackend,
+	keyring.PassBackend,
+	keyring.SecretServiceBackend,
+	keyring.KeychainBackend,
+	keyring.KWalletBackend,
+	keyring.KeyCtlBackend,
+	keyring.WinCredBackend,
+}
+
+func KeyringBackendFlag(c *cobra.Command, v *viper.Viper) {
+	names := make([]string, 0, len(keyringBackends))
+	for _, backend := range keyringBackends {
+		names = append(names, string(backend))
+	}
+	c.PersistentFlags().String(KEYRING_BACKEND, "", "keyring backend, one of "+strings.Join(names, ", ")+" (default the first available)")
+	v.BindPFlag(KEYRING_BACKEND, c.PersistentFlags().Lookup(KEYRING_BACKEND))
+}
+
+const KEYRING_DIR = "keyring-dir"
+
+func KeyringDirFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(KEYRING_DIR, "~/.config/gitall/keyring", "dir of the file keyring backend")
+	v.BindPFlag(KEYRING_DIR, c.PersistentFlags().Lookup(KEYRING_DIR))
+}
+
+const NON_INTERACTIVE = "non-interactive"
+
+func NonInteractiveFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(NON_INTERACTIVE, false, "fail instead of prompting for passwords, tokens or confirmation")
+	v.BindPFlag(NON_INTERACTIVE, c.PersistentFlags().Lookup(NON_INTERACTIVE))
+}
+
+func NonInteractiveGet() bool {
+	return GLOBAL.GetBool(NON_INTERACTIVE)
+}
+
+// ErrNonInteractive is returned instead of prompting with --non-interactive.
+// hint says how to give the value without a prompt.
+func ErrNonInteractive(what string, hint string) error {
+	return fmt.Errorf("could not prompt for %s with --non-interactive, %s", what, hint)
+}
+
+// env vars that override the secrets that are otherwise prompted for or kept
+// in the keyring. tokens are in TokenEnvGet.
+const KEYRING_PASSWORD_ENV = "GITALL_KEYRING_PASSWORD"
+const SSH_KEY_PASSWORD_ENV = "GITALL_SSH_KEY_PASSWORD"
+
+// KeyringConfigGet returns the keyring config for the settings in v
+func KeyringConfigGet(v *viper.Viper) (keyring.Config, error) {
+	config := keyring.Config{
+		ServiceName:      "gitall",
+		FileDir:          v.GetString(KEYRING_DIR),
+		FilePasswordFunc: keyringPasswordPrompt,
+		PassPrefix:       "gitall",
+	}
+	if config.FileDir == "" {
+		config.FileDir = "~/.config/gitall/keyring"
+	}
+	if backend := v.GetString(KEYRING_BACKEND); backend != "" {
+		for _, known := range keyringBackends {
+			if string(known) == backend {
+				config.AllowedBackends = []keyring.BackendType{known}
+				return config, nil
+			}
+		}
+		return config, fmt.Errorf("unknown keyring backend %q", backend)
+	}
+	return config, nil
+}
+
+// keyringPasswordPrompt gets the password of the file backend
+func keyringPasswordPrompt(label string) (string, error) {
+	if password := os.Getenv(KEYRING_PASSWORD_ENV); password != "" {
+		return password, nil
+	}
+	if NonInteractiveGet() {
+		return "", ErrNonInteractive("the file keyring password", "set "+KEYRING_PASSWORD_ENV)
+	}
+	return keyring.TerminalPrompt(label)
+}
+
 var ringCached keyring.Keyring
+var ringMu sync.Mutex
 
 func KeyringGet() keyring.Keyring {
+	ring, err := KeyringOpen()
+	if err != nil {
+		log.Fatalf("could not access keyring: %v. choose a backend with --%s", err, KEYRING_BACKEND)
+	}
+	return ring
+}
+
+// KeyringOpen is KeyringGet for callers that can do without a keyring
+func KeyringOpen() (keyring.Keyring, error) {
+	ringMu.Lock()
+	defer ringMu.Unlock()
 	if ringCached == nil {
-		var err error
-		ringCached, err = keyring.Open(keyring.Config{ServiceName: "gitall"})
+		config, err := KeyringConfigGet(GLOBAL)
+		if err != nil {
+			return nil, err
+		}
+		ringCached, err = keyring.Open(config)
 		if err != nil {
-			log.Fatalf("could not access keyring: %v", err)
+			return nil, err
 		}
 	}
-	return ringCached
+	return ringCached, nil
 }
 
 func Prompt(label string) string {
-	fmt.Print(label)
+	return PromptTo(os.Stdout, label)
+}
+
+// PromptTo asks on w, eg stderr when stdout carries the output of a command
+func PromptTo(w io.Writer, label string) string {
+	if NonInteractiveGet() {
+		log.Fatalf("could not ask %q with --non-interactive", strings.TrimSpace(label))
+	}
+	fmt.Fprint(w, label)
 	reader := bufio.NewReader(os.Stdin)
 	// ReadString will block until the delimiter is entered
 	input, err := reader.ReadString('\n')
@@ -42,6 +165,9 @@ func Prompt(label string) string {
 }
 
 func PromptSecret(label string) string {
+	if NonInteractiveGet() {
+		log.Fatalf("could not ask %q with --non-interactive", strings.TrimSpace(label))
+	}
 	var s string
 	fmt.Fprint(os.Stderr, label+" ")
 	b, err := term.ReadPassword(int(syscall.Stdin))
@@ -81,30 +207,48 @@ func PrvKPasswordFlag(c *cobra.Command, v *viper.Viper) {
 }
 
 func PrvKPasswordGet(v *viper.Viper, prvKFilePath string) (value string, err error) {
+	prompt := v.GetBool(SSH_KEY_PASS_PROMPT)
+
+	// the env var beats the keyring, but not -p
+	if password := os.Getenv(SSH_KEY_PASSWORD_ENV); password != "" && !prompt {
+		log.Debugf("got ssh key password from %s for %s", SSH_KEY_PASSWORD_ENV, prvKFilePath)
+		return password, nil
+	}
+
+	if prompt && NonInteractiveGet() {
+		return "", ErrNonInteractive("the ssh key password of "+prvKFilePath, "set "+SSH_KEY_PASSWORD_ENV)
+	}
+
 	ringKey := prvKFilePath
-	ringItem, err := KeyringGet().Get(ringKey)
+	var ringItem keyring.Item
+	ring, err := KeyringOpen()
+	if err == nil {
+		ringItem, err = ring.Get(ringKey)
+	}
 
 	// prompt if required or password not found
-	prompt := v.GetBool(SSH_KEY_PASS_PROMPT)
 	if prompt || err == keyring.ErrKeyNotFound {
 		if prompt {
 			log.Warnf("prompting by request...")
 		} else {
-			return "", fmt.Errorf("ssh key password not found in keychain. use -p to provide it")
+			return "", fmt.Errorf("ssh key password not found in keychain. use -p to provide it or set %s", SSH_KEY_PASSWORD_ENV)
 		}
-
 		// prompt
 		value = PromptSecret("Enter ssh key password: ")
 
 		// add
-		err = KeyringGet().Set(keyring.Item{Key: ringKey, Data: []byte(value)})
+		if ring == nil {
+			log.Warnf("not saving ssh key password, the keychain is not available")
+			return value, nil
+		}
+		err = ring.Set(keyring.Item{Key: ringKey, Data: []byte(value)})
 		if err != nil {
 			return "", fmt.Errorf("could not save ssh key password in keychain: %v", err)
 		} else {
 			log.Warnf("saved ssh key password in keychain for %s", prvKFilePath)
 		}
 	} else if err != nil {
-		return "", fmt.Errorf("could not query keychain for ssh key password: %v", err)
+		return "", fmt.Errorf("could not query keychain for ssh key password: %v. use -p or set %s", err, SSH_KEY_PASSWORD_ENV)
 	} else {
 		value = string(ringItem.Data)
 		log.Warnf("got ssh key password from keychain for %s. use -p to override with prompt", prvKFilePath)
@@ -112,80 +256,50 @@ func PrvKPasswordGet(v *viper.Viper, prvKFilePath string) (value string, err err
 	return
 }
 
-const GITHUB_PASS_PROMPT = "ghpass"
+const INSECURE_SKIP_TLS = "insecure-skip-tls"
 
-func GithubPassFlag(c *cobra.Command, v *viper.Viper) {
-	c.PersistentFlags().Bool(GITHUB_PASS_PROMPT, false, "prompt for github.com password")
-	v.BindPFlag(GITHUB_PASS_PROMPT, c.PersistentFlags().Lookup(GITHUB_PASS_PROMPT))
+func InsecureSkipTLSFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringSlice(INSECURE_SKIP_TLS, nil, "hosts whose https certificates are not verified")
+	v.BindPFlag(INSECURE_SKIP_TLS, c.PersistentFlags().Lookup(INSECURE_SKIP_TLS))
 }
 
-func GitHubPassGet(v *viper.Viper) (value string, err error) {
-	const ringKey = "ghpass"
-	ringItem, err := KeyringGet().Get(ringKey)
+func InsecureSkipTLSGet(v *viper.Viper) []string {
+	return v.GetStringSlice(INSECURE_SKIP_TLS)
+}
 
-	// prompt if required or password not found
-	prompt := v.GetBool(GITHUB_PASS_PROMPT)
-	if prompt || err == keyring.ErrKeyNotFound {
-		if prompt {
-			log.Warnf("prompting by request...")
-		} else {
-			return "", fmt.Errorf("github.com password not found in keychain. use --ghpass to provide it")
-		}
+const JOBS = "jobs"
 
-		// prompt
-		value = PromptSecret("Enter github.com password: ")
+func JobsFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().IntP(JOBS, "j", 8, "number of repos to process in parallel")
+	v.BindPFlag(JOBS, c.PersistentFlags().Lookup(JOBS))
+}
 
-		// add
-		err = KeyringGet().Set(keyring.Item{Key: ringKey, Data: []byte(value)})
-		if err != nil {
-			return "", fmt.Errorf("could not save github.com password in keychain: %v", err)
-		} else {
-			log.Warnf("saved github.com password in keychain")
-		}
-	} else if err != nil {
-		return "", fmt.Errorf("could not query keychain for github.com password: %v", err)
-	} else {
-		value = string(ringItem.Data)
-		log.Warnf("got github.com password from keychain. use -ghpass to override with prompt")
+func JobsGet(v *viper.Viper) int {
+	jobs := v.GetInt(JOBS)
+	if jobs < 1 {
+		jobs = 1
 	}
-	return
+	return jobs
 }
 
-const GITHUB_USER_PROMPT = "ghuser"
+const FETCH_TIMEOUT = "fetch-timeout"
 
-func GithubUserFlag(c *cobra.Command, v *viper.Viper) {
-	c.PersistentFlags().Bool(GITHUB_USER_PROMPT, false, "prompt for github.com username")
-	v.BindPFlag(GITHUB_USER_PROMPT, c.PersistentFlags().Lookup(GITHUB_USER_PROMPT))
+func FetchTimeoutFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Duration(FETCH_TIMEOUT, 60*time.Second, "timeout for fetching each repo (0 for none)")
+	v.BindPFlag(FETCH_TIMEOUT, c.PersistentFlags().Lookup(FETCH_TIMEOUT))
 }
 
-func GitHubUserGet(v *viper.Viper) (value string, err error) {
-	const ringKey = "ghuser"
-	ringItem, err := KeyringGet().Get(ringKey)
+func FetchTimeoutGet(v *viper.Viper) time.Duration {
+	return v.GetDuration(FETCH_TIMEOUT)
+}
 
-	// prompt if required or password not found
-	prompt := v.GetBool(GITHUB_USER_PROMPT)
-	if prompt || err == keyring.ErrKeyNotFound {
-		if prompt {
-			log.Warnf("prompting by request...")
-		} else {
-			return "", fmt.Errorf("github.com username not found in keychain. use --ghuser to provide it")
-		}
+const NO_FETCH = "no-fetch"
 
-		// prompt
-		value = Prompt("Enter username for github.com: ")
+func NoFetchFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(NO_FETCH, false, "use the existing remote tracking refs instead of fetching")
+	v.BindPFlag(NO_FETCH, c.PersistentFlags().Lookup(NO_FETCH))
+}
 
-		// add
-		err = KeyringGet().Set(keyring.Item{Key: ringKey, Data: []byte(value)})
-		if err != nil {
-			return "", fmt.Errorf("could not save github.com username in keychain: %v", err)
-		} else {
-			log.Warnf("saved github.com username in keychain")
-		}
-	} else if err != nil {
-		return "", fmt.Errorf("could not query keychain for github.com username: %v", err)
-	} else {
-		value = string(ringItem.Data)
-		log.Warnf("got github.com username from keychain. use -ghuser to override with prompt")
-	}
-	return
+func NoFetchGet(v *viper.Viper) bool {
+	return v.GetBool(NO_FETCH)
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	keyring "github.com/99designs/keyring"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -43,3 +47,92 @@ func TestPrvKFilePathGetReturnsExplicitPath(t *testing.T) {
 		t.Fatalf("unexpected explicit key path: %q", got)
 	}
 }
+
+func TestKeyringConfigGetUsesFileBackendFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GITALL_KEYRING_BACKEND", "file")
+	t.Setenv("GITALL_KEYRING_DIR", dir)
+	t.Setenv(KEYRING_PASSWORD_ENV, "secret")
+
+	v := viper.New()
+	GlobalFlags(&cobra.Command{}, v)
+	config, err := KeyringConfigGet(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.AllowedBackends) != 1 || config.AllowedBackends[0] != keyring.FileBackend || config.FileDir != dir {
+		t.Fatalf("unexpected keyring config %+v", config)
+	}
+
+	// the file backend takes its password from the env
+	ring, err := keyring.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Set(keyring.Item{Key: "k", Data: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	item, err := ring.Get("k")
+	if err != nil || string(item.Data) != "v" {
+		t.Fatalf("could not read back the item: %v", err)
+	}
+
+	t.Setenv("GITALL_KEYRING_BACKEND", "vault")
+	if _, err := KeyringConfigGet(v); err == nil {
+		t.Fatalf("expected an unknown backend to fail")
+	}
+}
+
+func TestNonInteractiveFailsInsteadOfPrompting(t *testing.T) {
+	GLOBAL.Set(NON_INTERACTIVE, true)
+	defer GLOBAL.Set(NON_INTERACTIVE, false)
+	t.Setenv(KEYRING_PASSWORD_ENV, "")
+	t.Setenv(SSH_KEY_PASSWORD_ENV, "")
+
+	if _, err := keyringPasswordPrompt("password"); err == nil || !strings.Contains(err.Error(), KEYRING_PASSWORD_ENV) {
+		t.Fatalf("expected the file keyring password prompt to fail, got %v", err)
+	}
+
+	v := viper.New()
+	c := &cobra.Command{}
+	PrvKPasswordFlag(c, v)
+	if err := c.PersistentFlags().Set(SSH_KEY_PASS_PROMPT, "true"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PrvKPasswordGet(v, "/tmp/key"); err == nil || !strings.Contains(err.Error(), "--non-interactive") {
+		t.Fatalf("expected the ssh key password prompt to fail, got %v", err)
+	}
+}
+
+func TestPrvKPasswordGetPrefersEnv(t *testing.T) {
+	t.Setenv(SSH_KEY_PASSWORD_ENV, "from-env")
+	v := viper.New()
+	PrvKPasswordFlag(&cobra.Command{}, v)
+
+	got, err := PrvKPasswordGet(v, "/tmp/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "from-env" {
+		t.Fatalf("expected the env password, got %q", got)
+	}
+}
+
+func TestPubKsGetChecksTheKeyBeforeThePassword(t *testing.T) {
+	GLOBAL.Set(NON_INTERACTIVE, true)
+	defer GLOBAL.Set(NON_INTERACTIVE, false)
+	t.Setenv(SSH_KEY_PASSWORD_ENV, "")
+
+	v := viper.New()
+	c := &cobra.Command{}
+	PrvKFilePathFlag(c, v)
+	PrvKPasswordFlag(c, v)
+	missing := filepath.Join(t.TempDir(), "id_missing")
+	c.PersistentFlags().Set(SSH_KEY_PATH, missing)
+	c.PersistentFlags().Set(SSH_KEY_PASS_PROMPT, "true")
+
+	_, err := PubKsGet(v)
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), missing) {
+		t.Fatalf("expected the missing key to be reported before the password, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type SyncState string
+
+const (
+	SyncInSync   SyncState = "in_sync"
+	SyncAhead    SyncState = "ahead"
+	SyncBehind   SyncState = "behind"
+	SyncDiverged SyncState = "diverged"
+
+	// the branch has no upstream branch to compare with
+	SyncNoUpstream SyncState = "no_upstream"
+	SyncGone       SyncState = "gone"
+)
+
+func SyncStateGet(ahead, behind int) SyncState {
+	switch {
+	case ahead > 0 && behind > 0:
+		return SyncDiverged
+	case ahead > 0:
+		return SyncAhead
+	case behind > 0:
+		return SyncBehind
+	}
+	return SyncInSync
+}
+
+type AheadBehind struct {
+	Ahead     int
+	Behind    int
+	MergeBase plumbing.Hash
+}
+
+func (ab AheadBehind) State() SyncState {
+	return SyncStateGet(ab.Ahead, ab.Behind)
+}
+
+// commit flags for the graph walk
+const (
+	reachLocal uint8 = 1 << iota
+	reachUpstream
+	reachBoth = reachLocal | reachUpstream
+)
+
+// AheadBehindGet counts the commits reachable from local but not upstream
+// (ahead) and from upstream but not local (behind). Like
+// `git rev-list --left-right --count`, it walks both sides newest first and
+// stops once every commit left in the queue is reachable from both.
+func AheadBehindGet(r *git.Repository, local, upstream plumbing.Hash) (ab AheadBehind, err error) {
+	if local == upstream {
+		ab.MergeBase = local
+		return ab, nil
+	}
+
+	localCommit, err := r.CommitObject(local)
+	if err != nil {
+		return ab, fmt.Errorf("could not get commit %s: %v", local, err)
+	}
+	upstreamCommit, err := r.CommitObject(upstream)
+	if err != nil {
+		return ab, fmt.Errorf("could not get commit %s: %v", upstream, err)
+	}
+
+	flags := map[plumbing.Hash]uint8{}
+	q := &commitQueue{}
+	// queued counts the queue entries per commit and pending the entries
+	// that are not yet reachable from both sides
+	queued := map[plumbing.Hash]int{}
+	pending := 0
+	mark := func(c *object.Commit, f uint8) {
+		old := flags[c.Hash]
+		if old|f == old {
+			return
+		}
+		flags[c.Hash] |= f
+		if flags[c.Hash] == reachBoth {
+			pending -= queued[c.Hash]
+		} else {
+			pending++
+		}
+		queued[c.Hash]++
+		heap.Push(q, c)
+	}
+	pop := func() *object.Commit {
+		c := heap.Pop(q).(*object.Commit)
+		queued[c.Hash]--
+		if flags[c.Hash] != reachBoth {
+			pending--
+		}
+		return c
+	}
+	mark(localCommit, reachLocal)
+	mark(upstreamCommit, reachUpstream)
+
+	for pending > 0 {
+		c := pop()
+		f := flags[c.Hash]
+		// like git's paint down, the first commit seen from both sides is
+		// the merge base
+		if f == reachBoth && ab.MergeBase.IsZero() {
+			ab.MergeBase = c.Hash
+		}
+		err = c.Parents().ForEach(func(p *object.Commit) error {
+			mark(p, f)
+			return nil
+		})
+		if err != nil {
+			return ab, fmt.Errorf("could not walk parents of %s: %v", c.Hash, err)
+		}
+	}
+	if ab.MergeBase.IsZero() && q.Len() > 0 {
+		ab.MergeBase = pop().Hash
+	}
+
+	for _, f := range flags {
+		switch f {
+		case reachLocal:
+			ab.Ahead++
+		case reachUpstream:
+			ab.Behind++
+		}
+	}
+	return ab, nil
+}
+
+// commitQueue is a max-heap of commits ordered by committer time
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)   { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
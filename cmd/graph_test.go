@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestAheadBehindGetCountsBothSides(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.work, "a.txt", "a\n", "local 1")
+	commitFile(t, repos.work, "b.txt", "b\n", "local 2")
+	base := headHash(t, repos.origin)
+	commitFile(t, repos.origin, "c.txt", "c\n", "origin 1")
+
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Fetch(&git.FetchOptions{RemoteName: "origin"}); err != nil {
+		t.Fatal(err)
+	}
+	local := refHash(t, r, plumbing.NewBranchReferenceName("master"))
+	upstream := refHash(t, r, plumbing.NewRemoteReferenceName("origin", "master"))
+
+	ab, err := AheadBehindGet(r, local, upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ab.Ahead != 2 || ab.Behind != 1 {
+		t.Fatalf("unexpected counts: %#v", ab)
+	}
+	if ab.State() != SyncDiverged {
+		t.Fatalf("unexpected state: %s", ab.State())
+	}
+	if ab.MergeBase != base {
+		t.Fatalf("unexpected merge base: got %s want %s", ab.MergeBase, base)
+	}
+
+	ab, err = AheadBehindGet(r, upstream, upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ab.State() != SyncInSync {
+		t.Fatalf("same commit should be in sync: %#v", ab)
+	}
+}
+
+func TestAheadBehindGetUnrelatedHistories(t *testing.T) {
+	repos := newLocalClone(t)
+	other := filepath.Join(t.TempDir(), "other")
+	if _, err := git.PlainInit(other, false); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, other, "other.txt", "other\n", "unrelated")
+
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CreateRemote(&config.RemoteConfig{Name: "other", URLs: []string{other}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Fetch(&git.FetchOptions{RemoteName: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	local := refHash(t, r, plumbing.NewBranchReferenceName("master"))
+	upstream := refHash(t, r, plumbing.NewRemoteReferenceName("other", "master"))
+
+	ab, err := AheadBehindGet(r, local, upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ab.Ahead != 1 || ab.Behind != 1 || !ab.MergeBase.IsZero() {
+		t.Fatalf("unexpected unrelated histories: %#v", ab)
+	}
+
+	// the status leaves the merge base out
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Branches["master"].Remote = "other"
+	if err := r.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	status := GitStatusGet(context.Background(), nil, repos.work, StatiOpts{NoFetch: true})
+	if len(status.Branches) != 1 || status.Branches[0].Sync != SyncDiverged || status.Branches[0].MergeBase != "" {
+		t.Fatalf("unexpected branch status: %#v", status.Branches)
+	}
+}
+
+func TestGitStatiGetReportsAheadBehind(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.work, "a.txt", "a\n", "local 1")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status, ok := s.NeedsSyncList[repos.work]
+	if !ok || len(status.Branches) != 1 {
+		t.Fatalf("repo ahead of origin should need sync: %#v", s)
+	}
+	b := status.Branches[0]
+	if b.Sync != SyncAhead || b.Ahead != 1 || b.Behind != 0 {
+		t.Fatalf("unexpected sync status: %#v", b)
+	}
+	if AheadBehindText(b) != "↑1 ↓0" {
+		t.Fatalf("unexpected ahead/behind text: %q", AheadBehindText(b))
+	}
+
+	repos = newLocalClone(t)
+	commitFile(t, repos.origin, "b.txt", "b\n", "origin 1")
+	s = GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status = s.NeedsSyncList[repos.work]
+	if len(status.Branches) != 1 {
+		t.Fatalf("expected one branch: %#v", status)
+	}
+	b = status.Branches[0]
+	if b.Sync != SyncBehind || b.Ahead != 0 || b.Behind != 1 {
+		t.Fatalf("unexpected sync status: %#v", b)
+	}
+}
+
+func headHash(t *testing.T, repoPath string) plumbing.Hash {
+	t.Helper()
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Hash()
+}
+
+func refHash(t *testing.T, r *git.Repository, name plumbing.ReferenceName) plumbing.Hash {
+	t.Helper()
+
+	ref, err := r.Reference(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Hash()
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+const STRICT_HOST_KEYS = "strict-host-keys"
+
+func StrictHostKeysFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().Bool(STRICT_HOST_KEYS, false, "refuse ssh hosts that are not in known_hosts instead of asking to add them")
+	v.BindPFlag(STRICT_HOST_KEYS, c.PersistentFlags().Lookup(STRICT_HOST_KEYS))
+}
+
+// HostKeys verifies ssh host keys against the known_hosts files. The key of
+// an unknown host is shown and appended to the first file once the user
+// confirms it, unless strict is set or there is no one to ask. Changed keys
+// are always refused.
+type HostKeys struct {
+	files  []string
+	strict bool
+	// confirm asks whether to trust a key. nil means there is no one to ask.
+	confirm func(question string) bool
+
+	mu       sync.Mutex
+	callback ssh.HostKeyCallback
+	// the answers for unknown hosts, so each is asked once
+	answers map[string]bool
+
+	// the time spent waiting for answers, which fetch timeouts leave out
+	waitMu  sync.Mutex
+	waited  time.Duration
+	askedAt time.Time
+}
+
+// HostKeysNew reads the files in SSH_KNOWN_HOSTS or else ~/.ssh/known_hosts
+// and /etc/ssh/ssh_known_hosts, like go-git does
+func HostKeysNew(v *viper.Viper) *HostKeys {
+	files := filepath.SplitList(os.Getenv("SSH_KNOWN_HOSTS"))
+	if len(files) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+	}
+
+	var confirm func(string) bool
+	if !NonInteractiveGet() && term.IsTerminal(int(syscall.Stdin)) {
+		confirm = func(question string) bool {
+			// stdout may carry json output
+			response := PromptTo(os.Stderr, question)
+			return response == "y" || response == "Y" || response == "yes"
+		}
+	}
+	return hostKeysNew(files, v.GetBool(STRICT_HOST_KEYS), confirm)
+}
+
+func hostKeysNew(files []string, strict bool, confirm func(string) bool) *HostKeys {
+	return &HostKeys{files: files, strict: strict, confirm: confirm, answers: make(map[string]bool)}
+}
+
+// HostKeyError is a host key that was refused
+type HostKeyError struct {
+	// Host is as in known_hosts, eg example.com or [example.com]:2222
+	Host        string
+	KeyType     string
+	Fingerprint string
+	// Known is set when the key does not match the known keys
+	Known  []knownhosts.KnownKey
+	Reason string
+}
+
+func (e *HostKeyError) Error() string {
+	offered := fmt.Sprintf("%s key %s", e.KeyType, e.Fingerprint)
+	if len(e.Known) > 0 {
+		lines := make([]string, 0, len(e.Known))
+		for _, known := range e.Known {
+			lines = append(lines, fmt.Sprintf("%s:%d (%s)", known.Filename, known.Line, known.Key.Type()))
+		}
+		return fmt.Sprintf("host key of %s changed, it offered %s but known_hosts has another key at %s. remove that line only if you know why the key changed",
+			e.Host, offered, strings.Join(lines, ", "))
+	}
+	return fmt.Sprintf("%s is not in known_hosts, it offered %s. %s. check the fingerprint and run `%s >> ~/.ssh/known_hosts`",
+		e.Host, offered, e.Reason, KeyscanCommand(e.Host))
+}
+
+// KeyscanCommand is the ssh-keyscan command for a known_hosts host
+func KeyscanCommand(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if h, port, err := net.SplitHostPort(host); err == nil {
+			return "ssh-keyscan -p " + port + " " + strings.Trim(h, "[]")
+		}
+	}
+	return "ssh-keyscan " + host
+}
+
+// Callback is an ssh.HostKeyCallback. Prompts are serialized, so parallel
+// fetches ask about each host once.
+func (h *HostKeys) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	host := knownhosts.Normalize(hostname)
+	keyErr := &HostKeyError{Host: host, KeyType: key.Type(), Fingerprint: ssh.FingerprintSHA256(key)}
+
+	err := h.check(hostname, remote, key)
+	var unknown *knownhosts.KeyError
+	var revoked *knownhosts.RevokedError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &revoked):
+		return fmt.Errorf("host key of %s is revoked at %s:%d", host, revoked.Revoked.Filename, revoked.Revoked.Line)
+	case !errors.As(err, &unknown):
+		return err
+	case len(unknown.Want) > 0:
+		keyErr.Known = unknown.Want
+		return keyErr
+	}
+
+	// trust on first use
+	if trusted, asked := h.answers[host]; asked {
+		if trusted {
+			return nil
+		}
+		keyErr.Reason = "it was not trusted"
+		return keyErr
+	}
+	if h.strict {
+		keyErr.Reason = "--" + STRICT_HOST_KEYS + " is set"
+		return keyErr
+	}
+	if h.confirm == nil {
+		keyErr.Reason = "there is no terminal to confirm it"
+		return keyErr
+	}
+	fmt.Fprintf(os.Stderr, "The authenticity of host %s can not be established."+NL+"Its %s key fingerprint is %s."+NL, host, keyErr.KeyType, keyErr.Fingerprint)
+	h.waitStart()
+	trusted := h.confirm(fmt.Sprintf("Add it to %s? [y/N]: ", h.files[0]))
+	h.waitEnd()
+	h.answers[host] = trusted
+	if !trusted {
+		keyErr.Reason = "it was not trusted"
+		return keyErr
+	}
+	if err := h.add(host, key); err != nil {
+		return fmt.Errorf("could not add the host key of %s: %v", host, err)
+	}
+	log.Warnf("added the %s key of %s to %s", keyErr.KeyType, host, h.files[0])
+	return nil
+}
+
+func (h *HostKeys) waitStart() {
+	h.waitMu.Lock()
+	defer h.waitMu.Unlock()
+	h.askedAt = time.Now()
+}
+
+func (h *HostKeys) waitEnd() {
+	h.waitMu.Lock()
+	defer h.waitMu.Unlock()
+	h.waited += time.Since(h.askedAt)
+	h.askedAt = time.Time{}
+}
+
+// Waited returns the time spent waiting for answers so far, including a
+// question that is still open
+func (h *HostKeys) Waited() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.waitMu.Lock()
+	defer h.waitMu.Unlock()
+	if h.askedAt.IsZero() {
+		return h.waited
+	}
+	return h.waited + time.Since(h.askedAt)
+}
+
+// TimeoutCtx is like context.WithTimeout, except that the time spent waiting
+// for an answer about a host key does not count
+func (h *HostKeys) TimeoutCtx(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if h == nil || h.confirm == nil {
+		return context.WithTimeout(ctx, timeout)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	start, waited := time.Now(), h.Waited()
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			left := timeout - time.Since(start) + (h.Waited() - waited)
+			if left <= 0 {
+				cancel()
+				return
+			}
+			timer.Reset(left)
+		}
+	}()
+	return ctx, cancel
+}
+
+// check runs the known_hosts callback, which is loaded on first use
+func (h *HostKeys) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if h.callback == nil {
+		existing := make([]string, 0, len(h.files))
+		for _, file := range h.files {
+			if _, err := os.Stat(file); err == nil {
+				existing = append(existing, file)
+			}
+		}
+		if len(existing) == 0 {
+			return &knownhosts.KeyError{}
+		}
+		callback, err := knownhosts.New(existing...)
+		if err != nil {
+			return fmt.Errorf("could not read known_hosts: %v", err)
+		}
+		h.callback = callback
+	}
+	return h.callback(hostname, remote, key)
+}
+
+// add appends the key to the first file and reloads the files
+func (h *HostKeys) add(host string, key ssh.PublicKey) error {
+	file := h.files[0]
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// do not join the line to a last line without a newline
+	line := knownhosts.Line([]string{host}, key) + NL
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if r, err := os.Open(file); err == nil {
+			r.ReadAt(last, info.Size()-1)
+			r.Close()
+		}
+		if last[0] != '\n' {
+			line = NL + line
+		}
+	}
+	if _, err := f.WriteString(line); err != nil {
+		return err
+	}
+	h.callback = nil
+	return nil
+}
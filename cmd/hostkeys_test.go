@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func hostKeyNew(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var hostKeysRemote = &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+
+func TestHostKeysTrustsOnFirstUseAfterConfirmation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	other := hostKeyNew(t)
+	// an existing file without a trailing newline
+	if err := os.WriteFile(file, []byte(knownhosts.Line([]string{"other.example.com"}, other)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := hostKeyNew(t)
+	asked := 0
+	hostKeys := hostKeysNew([]string{file}, false, func(question string) bool {
+		asked++
+		return true
+	})
+	for i := 0; i < 2; i++ {
+		if err := hostKeys.Callback("gitea.local:2222", hostKeysRemote, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if asked != 1 {
+		t.Fatalf("expected to be asked once, was asked %d times", asked)
+	}
+
+	// a new run knows both hosts without asking
+	hostKeys = hostKeysNew([]string{file}, true, nil)
+	if err := hostKeys.Callback("gitea.local:2222", hostKeysRemote, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := hostKeys.Callback("other.example.com:22", hostKeysRemote, other); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostKeysRefusesUnknownHostsWhenStrict(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	key := hostKeyNew(t)
+	hostKeys := hostKeysNew([]string{file}, true, func(string) bool {
+		t.Fatalf("expected no question with strict host keys")
+		return true
+	})
+
+	err := hostKeys.Callback("gitea.local:2222", hostKeysRemote, key)
+	var keyErr *HostKeyError
+	if !errors.As(err, &keyErr) {
+		t.Fatalf("expected a HostKeyError, got %v", err)
+	}
+	for _, want := range []string{"[gitea.local]:2222", ssh.FingerprintSHA256(key), "ssh-keyscan -p 2222 gitea.local", STRICT_HOST_KEYS} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %q", want, err.Error())
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("expected known_hosts to be left alone")
+	}
+
+	// without a terminal there is no one to ask either
+	hostKeys = hostKeysNew([]string{file}, false, nil)
+	if err := hostKeys.Callback("gitea.local:22", hostKeysRemote, key); err == nil || !strings.Contains(err.Error(), "ssh-keyscan gitea.local") {
+		t.Fatalf("expected an unknown host error, got %v", err)
+	}
+}
+
+func TestHostKeysRefusesChangedKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(file, []byte(knownhosts.Line([]string{"gitea.local"}, hostKeyNew(t))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hostKeys := hostKeysNew([]string{file}, false, func(string) bool {
+		t.Fatalf("expected no question for a changed key")
+		return true
+	})
+
+	err := hostKeys.Callback("gitea.local:22", hostKeysRemote, hostKeyNew(t))
+	var keyErr *HostKeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Known) != 1 {
+		t.Fatalf("expected a changed key error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "changed") || !strings.Contains(err.Error(), file+":1") {
+		t.Fatalf("expected the known_hosts line in %q", err.Error())
+	}
+}
+
+func TestHostKeysTimeoutCtxPausesWhileAsking(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	hostKeys := hostKeysNew([]string{file}, false, func(question string) bool {
+		time.Sleep(100 * time.Millisecond)
+		return false
+	})
+
+	ctx, cancel := hostKeys.TimeoutCtx(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	hostKeys.Callback("gitea.local:2222", hostKeysRemote, hostKeyNew(t))
+	if ctx.Err() != nil {
+		t.Fatalf("expected the time spent asking not to count")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the timeout to run once answered")
+	}
+}
+
+func TestErrKnownHostsWrapNamesTheHost(t *testing.T) {
+	unknown := errors.New("ssh: handshake failed: knownhosts: key is unknown")
+	for url, want := range map[string]string{
+		"ssh://git@git.example.com:2222/team/a.git": "`ssh-keyscan -p 2222 git.example.com`",
+		"git@github.com:me/repo.git":                "`ssh-keyscan github.com`",
+	} {
+		if err := ErrKnownHostsWrap(unknown, url); !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %s for %s, got %v", want, url, err)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if err := ErrKnownHostsWrap(other, "git@github.com:me/repo.git"); err != other {
+		t.Fatalf("expected other errors to pass through, got %v", err)
+	}
+}
@@ -14,6 +14,20 @@ var MAIN = &cobra.Command{
 }
 
 func init() {
+	GlobalFlags(MAIN, GLOBAL)
+
+	CMDAuthInit()
+	CMDBranchInit()
+	CMDCheckoutInit()
+	CMDCloneInit()
+	CMDCommitInit()
+	CMDExecInit()
+	CMDGrepInit()
+	CMDLogInit()
+	CMDPullInit()
+	CMDPushInit()
+	CMDSnapshotInit()
+	CMDStashInit()
 	CMDStatusInit()
 	CMDUpdateTapInit()
 	CMDWhatWhereInit()
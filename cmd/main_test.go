@@ -3,7 +3,7 @@ package main
 import "testing"
 
 func TestMainCommandRegistersSubcommands(t *testing.T) {
-	for _, name := range []string{"status", "updatetap", "whatwhere"} {
+	for _, name := range []string{"auth", "branch", "checkout", "clone", "commit", "exec", "grep", "log", "pull", "push", "snapshot", "stash", "status", "updatetap", "whatwhere"} {
 		cmd, _, err := MAIN.Find([]string{name})
 		if err != nil {
 			t.Fatalf("find command %q: %v", name, err)
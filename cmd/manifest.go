@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const MANIFEST_FILE = ".gitall.yaml"
+
+// the selector for every repo in the manifest
+const GROUP_ALL = "all"
+
+// Manifest describes the repos of a workspace. eg...
+//
+//	repos:
+//	  - path: api
+//	    url: git@github.com:org/api.git
+//	    branch: main
+//	    groups: [backend]
+//	    remotes:
+//	      upstream: git@github.com:other/api.git
+type Manifest struct {
+	// File is the path of the manifest. Repo paths are relative to its dir.
+	File  string         `yaml:"-"`
+	Repos []ManifestRepo `yaml:"repos"`
+}
+
+type ManifestRepo struct {
+	Path    string            `yaml:"path"`
+	URL     string            `yaml:"url"`
+	Branch  string            `yaml:"branch"`
+	Groups  []string          `yaml:"groups"`
+	Remotes map[string]string `yaml:"remotes"`
+}
+
+const MANIFEST = "manifest"
+
+func ManifestFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().String(MANIFEST, "", "workspace manifest (default: search upward for "+MANIFEST_FILE+")")
+	v.BindPFlag(MANIFEST, c.PersistentFlags().Lookup(MANIFEST))
+}
+
+// ManifestFind searches upward from dir for the manifest file
+func ManifestFind(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, MANIFEST_FILE)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", os.ErrNotExist
+		}
+		dir = parent
+	}
+}
+
+// ManifestGet loads the manifest from the flag or the nearest manifest file
+func ManifestGet(v *viper.Viper) (*Manifest, error) {
+	path := v.GetString(MANIFEST)
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path, err = ManifestFind(cwd)
+		if err != nil {
+			return nil, fmt.Errorf("could not find %s in %s or any parent dir", MANIFEST_FILE, cwd)
+		}
+	}
+	return ManifestLoad(path)
+}
+
+// ManifestLoad decodes the manifest with yaml directly. viper lowercases map
+// keys, which would rename remotes like `myFork`.
+func ManifestLoad(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest %s: %v", path, err)
+	}
+
+	m := &Manifest{}
+	err = yaml.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse manifest %s: %v", path, err)
+	}
+	m.File, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, repo := range m.Repos {
+		if repo.Path == "" {
+			return nil, fmt.Errorf("manifest %s: repo %d has no path", path, i)
+		}
+	}
+	return m, nil
+}
+
+// Dir returns the dir of a manifest repo, relative to the cwd when inside it
+func (m *Manifest) Dir(repo ManifestRepo) string {
+	dir := repo.Path
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(m.File), dir)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return dir
+}
+
+// Select returns the repos in a group. `all` selects every repo.
+func (m *Manifest) Select(group string) []ManifestRepo {
+	repos := make([]ManifestRepo, 0)
+	for _, repo := range m.Repos {
+		if group == GROUP_ALL {
+			repos = append(repos, repo)
+			continue
+		}
+		for _, g := range repo.Groups {
+			if g == group {
+				repos = append(repos, repo)
+				break
+			}
+		}
+	}
+	return repos
+}
+
+// Groups lists every group named by a repo
+func (m *Manifest) Groups() []string {
+	seen := make(map[string]bool)
+	groups := make([]string, 0)
+	for _, repo := range m.Repos {
+		for _, g := range repo.Groups {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// ManifestDirsGet expands `@group` selectors to the dirs of the repos in them
+func ManifestDirsGet(m *Manifest, selectors []string) ([]string, error) {
+	seen := make(map[string]bool)
+	dirs := make([]string, 0)
+	for _, selector := range selectors {
+		group := strings.TrimPrefix(selector, "@")
+		repos := m.Select(group)
+		if len(repos) == 0 {
+			return nil, fmt.Errorf("no repos in group @%s of %s. groups are: %s", group, m.File, strings.Join(m.Groups(), ", "))
+		}
+		for _, repo := range repos {
+			dir := m.Dir(repo)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const testManifest = `repos:
+  - path: api
+    url: git@example.com:org/api.git
+    branch: main
+    groups: [backend]
+    remotes:
+      upstream: git@example.com:other/api.git
+      myFork: git@example.com:me/api.git
+  - path: worker
+    url: git@example.com:org/worker.git
+    groups: [backend, jobs]
+  - path: web
+    url: git@example.com:org/web.git
+    groups: [frontend]
+`
+
+func TestManifestFindSearchesUpward(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, MANIFEST_FILE), []byte(testManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deep := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ManifestFind(deep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != filepath.Join(root, MANIFEST_FILE) {
+		t.Fatalf("unexpected manifest path: %q", got)
+	}
+
+	m, err := ManifestLoad(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Repos) != 3 || m.Repos[0].Branch != "main" || m.Repos[0].Remotes["upstream"] != "git@example.com:other/api.git" {
+		t.Fatalf("unexpected manifest: %#v", m)
+	}
+	if m.Repos[0].Remotes["myFork"] != "git@example.com:me/api.git" {
+		t.Fatalf("expected remote names to keep their case: %v", m.Repos[0].Remotes)
+	}
+	if !reflect.DeepEqual(m.Groups(), []string{"backend", "frontend", "jobs"}) {
+		t.Fatalf("unexpected groups: %v", m.Groups())
+	}
+}
+
+func TestDirsGetExpandsGroupSelectors(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, MANIFEST_FILE), []byte(testManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, root)
+
+	v := viper.New()
+	c := &cobra.Command{}
+	DirsFlags(c, v)
+
+	dirs, err := DirsGet(v, []string{"@backend", "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"other", "api", "worker"}) {
+		t.Fatalf("unexpected dirs: %v", dirs)
+	}
+
+	dirs, err = DirsGet(v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"api", "worker", "web"}) {
+		t.Fatalf("no args should select every repo: %v", dirs)
+	}
+
+	if _, err := DirsGet(v, []string{"@missing"}); err == nil {
+		t.Fatal("expected error for unknown group")
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// Operation is a multi step git command that is halfway done in a repo
+type Operation string
+
+const (
+	OpMerge      Operation = "merging"
+	OpRebase     Operation = "rebasing"
+	OpApply      Operation = "applying"
+	OpCherryPick Operation = "cherry_picking"
+	OpRevert     Operation = "reverting"
+	OpBisect     Operation = "bisecting"
+)
+
+// the files git leaves in the git dir, in the order they are checked
+var operationFiles = []struct {
+	file string
+	op   Operation
+}{
+	{"rebase-merge", OpRebase},
+	{"rebase-apply/applying", OpApply},
+	{"rebase-apply", OpRebase},
+	{"MERGE_HEAD", OpMerge},
+	{"CHERRY_PICK_HEAD", OpCherryPick},
+	{"REVERT_HEAD", OpRevert},
+	{"BISECT_LOG", OpBisect},
+}
+
+var operations = []Operation{OpMerge, OpRebase, OpApply, OpCherryPick, OpRevert, OpBisect}
+
+// OperationGet returns the operation in progress in r, or "" if there is none
+func OperationGet(r *git.Repository) Operation {
+	storage, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return ""
+	}
+	fs := storage.Filesystem()
+	for _, of := range operationFiles {
+		if _, err := fs.Stat(of.file); err == nil {
+			return of.op
+		}
+	}
+	return ""
+}
+
+func (op Operation) Valid() bool {
+	for _, valid := range operations {
+		if op == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Detail is eg `rebase in progress`
+func (op Operation) Detail() string {
+	switch op {
+	case OpMerge:
+		return "merge in progress"
+	case OpRebase:
+		return "rebase in progress"
+	case OpApply:
+		return "am in progress"
+	case OpCherryPick:
+		return "cherry-pick in progress"
+	case OpRevert:
+		return "revert in progress"
+	case OpBisect:
+		return "bisect in progress"
+	}
+	return ""
+}
+
+// Refusal is why mutating commands refuse a repo with the operation
+func (op Operation) Refusal() string {
+	return op.Detail() + ", finish or abort it first"
+}
+
+// OperationCheck returns the refusal as an error when an operation is in
+// progress in r
+func OperationCheck(r *git.Repository) error {
+	if op := OperationGet(r); op != "" {
+		return errors.New(op.Refusal())
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+func TestOperationGet(t *testing.T) {
+	for file, want := range map[string]Operation{
+		"MERGE_HEAD":            OpMerge,
+		"rebase-merge/":         OpRebase,
+		"rebase-apply/":         OpRebase,
+		"rebase-apply/applying": OpApply,
+		"CHERRY_PICK_HEAD":      OpCherryPick,
+		"REVERT_HEAD":           OpRevert,
+		"BISECT_LOG":            OpBisect,
+	} {
+		repos := newLocalClone(t)
+		operationStart(t, repos.work, file)
+		r, err := git.PlainOpen(repos.work)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op := OperationGet(r); op != want {
+			t.Fatalf("%s should be %s, not %q", file, want, op)
+		}
+	}
+}
+
+func TestOperationInProgressIsReportedAndRefused(t *testing.T) {
+	repos := newLocalClone(t)
+	commitFile(t, repos.origin, "README.md", "new origin commit\n", "advance origin")
+	operationStart(t, repos.work, "rebase-merge/")
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status, ok := s.InProgressList[repos.work]
+	if !ok || status.Operation != OpRebase || status.Detail != "rebase in progress" || !StatusIs(status, "rebasing", "in_progress") {
+		t.Fatalf("repo should be rebasing: %#v", s)
+	}
+
+	results := GitPull(status, PullOpts{})
+	if len(results) != 1 || results[0].State != ActionRefused || results[0].Detail != OpRebase.Refusal() {
+		t.Fatalf("pull should refuse: %#v", results)
+	}
+	if results := GitPush(context.Background(), nil, status, PushOpts{}); len(results) != 1 || results[0].State != ActionRefused {
+		t.Fatalf("push should refuse: %#v", results)
+	}
+	if plan := SwitchPlanGet(repos.work, "feature/x", "", true); plan.Error != OpRebase.Refusal() {
+		t.Fatalf("branch create should refuse: %#v", plan)
+	}
+	global := config.NewConfig()
+	global.User.Name, global.User.Email = "Global", "global@example.com"
+	if plan := CommitPlanGet(repos.work, false, global); plan.Refused != OpRebase.Refusal() {
+		t.Fatalf("commit should refuse: %#v", plan)
+	}
+	if result := GitStashSave(repos.work, STASH_MESSAGE, false, false); result.State != ActionRefused {
+		t.Fatalf("stash should refuse: %#v", result)
+	}
+}
+
+// operationStart leaves the file or dir, when it ends in /, that git keeps
+// during an operation
+func operationStart(t *testing.T, repoPath string, file string) {
+	t.Helper()
+
+	path := filepath.Join(repoPath, ".git", file)
+	if strings.HasSuffix(file, "/") {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("0123456789012345678901234567890123456789\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OUTPUT_TEXT   = "text"
+	OUTPUT_JSON   = "json"
+	OUTPUT_YAML   = "yaml"
+	OUTPUT_NDJSON = "ndjson"
+	// OUTPUT_MARKDOWN is only for reports, see LogOutputGet
+	OUTPUT_MARKDOWN = "markdown"
+)
+
+const OUTPUT = "output"
+
+func OutputFlag(c *cobra.Command, v *viper.Viper) {
+	c.PersistentFlags().StringP(OUTPUT, "o", OUTPUT_TEXT, "output format: text, json, yaml or ndjson")
+	v.BindPFlag(OUTPUT, c.PersistentFlags().Lookup(OUTPUT))
+}
+
+func OutputGet(v *viper.Viper) (string, error) {
+	output := v.GetString(OUTPUT)
+	switch output {
+	case OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML, OUTPUT_NDJSON:
+		return output, nil
+	}
+	return "", fmt.Errorf("unknown output format %q. use text, json, yaml or ndjson", output)
+}
+
+// OutputWrite renders items in one of the machine readable formats
+func OutputWrite[T any](w io.Writer, output string, items []T) error {
+	switch output {
+	case OUTPUT_JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case OUTPUT_YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(items); err != nil {
+			return err
+		}
+		return enc.Close()
+	case OUTPUT_NDJSON:
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("output format %q is not machine readable", output)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func TestOutputGetRejectsUnknownFormat(t *testing.T) {
+	v := viper.New()
+	c := &cobra.Command{}
+	OutputFlag(c, v)
+
+	got, err := OutputGet(v)
+	if err != nil || got != OUTPUT_TEXT {
+		t.Fatalf("default output should be text: %q %v", got, err)
+	}
+
+	if err := c.PersistentFlags().Set(OUTPUT, "xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OutputGet(v); err == nil {
+		t.Fatal("expected error for unknown output format")
+	}
+}
+
+func TestOutputWriteStatusSchema(t *testing.T) {
+	repos := newLocalClone(t)
+	if err := os.WriteFile(filepath.Join(repos.work, "README.md"), []byte("dirty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repos.work, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	s := GitStatiGet(context.Background(), nil, []string{repos.work, missing}, StatiOpts{})
+
+	var out bytes.Buffer
+	if err := OutputWrite(&out, OUTPUT_JSON, s.List()); err != nil {
+		t.Fatal(err)
+	}
+	var list []Status
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("unexpected json list: %s", out.String())
+	}
+	byDir := map[string]Status{}
+	for _, status := range list {
+		byDir[status.Dir] = status
+	}
+	work := byDir[repos.work]
+	if work.Class != ClassNeedsCommit || work.Unstaged != 1 || work.Untracked != 1 || work.RemoteURL != repos.origin {
+		t.Fatalf("unexpected work status: %#v", work)
+	}
+	if len(work.Branches) != 1 || work.Branches[0].Sync != SyncInSync {
+		t.Fatalf("unexpected work branches: %#v", work.Branches)
+	}
+	if byDir[missing].Class != ClassError || byDir[missing].Error == "" {
+		t.Fatalf("unexpected missing status: %#v", byDir[missing])
+	}
+	if strings.Contains(out.String(), "\033[") {
+		t.Fatalf("json output must not contain colors: %s", out.String())
+	}
+
+	out.Reset()
+	if err := OutputWrite(&out, OUTPUT_NDJSON, s.List()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one ndjson line per repo: %s", out.String())
+	}
+
+	out.Reset()
+	if err := OutputWrite(&out, OUTPUT_YAML, s.List()); err != nil {
+		t.Fatal(err)
+	}
+	var yamlList []map[string]any
+	if err := yaml.Unmarshal(out.Bytes(), &yamlList); err != nil {
+		t.Fatal(err)
+	}
+	if len(yamlList) != 2 || yamlList[0]["class"] == nil {
+		t.Fatalf("unexpected yaml output: %s", out.String())
+	}
+}
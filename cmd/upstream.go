@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Upstream is the branch a local branch tracks, as configured by
+// branch.<name>.remote and branch.<name>.merge
+type Upstream struct {
+	Remote string
+	Merge  plumbing.ReferenceName
+}
+
+func UpstreamGet(cfg *config.Config, branch string) (u Upstream, ok bool) {
+	bc, ok := cfg.Branches[branch]
+	if !ok || bc.Remote == "" || bc.Merge == "" {
+		return u, false
+	}
+	return Upstream{Remote: bc.Remote, Merge: bc.Merge}, true
+}
+
+// IsLocal is true when the upstream is another local branch (remote = .)
+func (u Upstream) IsLocal() bool {
+	return u.Remote == "."
+}
+
+// RefName maps the merge ref to its remote tracking ref through the fetch
+// refspecs of the remote
+func (u Upstream) RefName(cfg *config.Config) plumbing.ReferenceName {
+	if u.IsLocal() {
+		return u.Merge
+	}
+	if remote, ok := cfg.Remotes[u.Remote]; ok {
+		for _, rs := range remote.Fetch {
+			if rs.Match(u.Merge) {
+				return rs.Dst(u.Merge)
+			}
+		}
+	}
+	return plumbing.NewRemoteReferenceName(u.Remote, u.Merge.Short())
+}
+
+func (u Upstream) String() string {
+	if u.IsLocal() {
+		return u.Merge.Short()
+	}
+	return u.Remote + "/" + u.Merge.Short()
+}
+
+// UpstreamRemotesGet lists the configured remotes that any branch tracks
+func UpstreamRemotesGet(cfg *config.Config) []string {
+	seen := make(map[string]bool)
+	remotes := make([]string, 0)
+	for name := range cfg.Branches {
+		u, ok := UpstreamGet(cfg, name)
+		if !ok || u.IsLocal() || seen[u.Remote] {
+			continue
+		}
+		if _, ok := cfg.Remotes[u.Remote]; !ok {
+			continue
+		}
+		seen[u.Remote] = true
+		remotes = append(remotes, u.Remote)
+	}
+	sort.Strings(remotes)
+	return remotes
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestGitStatiGetHonorsConfiguredUpstream(t *testing.T) {
+	repos := newLocalClone(t)
+
+	// a second remote with a differently named branch
+	other := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:  "upstream",
+		URLs:  []string{other.origin},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/upstream/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRepo, err := git.PlainOpen(other.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := otherRepo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("topic"), head.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.CreateBranch(&config.Branch{Name: "topic", Remote: "upstream", Merge: "refs/heads/trunk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trunk := commitFile(t, other.origin, "b.txt", "b\n", "advance trunk")
+	err = otherRepo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("trunk"), trunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status, ok := s.NeedsSyncList[repos.work]
+	if !ok {
+		t.Fatalf("repo behind its upstream should need sync: %#v", s)
+	}
+	byName := map[string]BranchStatus{}
+	for _, b := range status.Branches {
+		byName[b.Name] = b
+	}
+	topic := byName["topic"]
+	if topic.Upstream != "upstream/trunk" || topic.Sync != SyncBehind || topic.Behind != 1 {
+		t.Fatalf("unexpected topic status: %#v", topic)
+	}
+	if byName["master"].Upstream != "origin/master" || byName["master"].Sync != SyncInSync {
+		t.Fatalf("unexpected master status: %#v", byName["master"])
+	}
+}
+
+func TestGitStatiGetNoUpstreamIsNotOutOfSync(t *testing.T) {
+	repos := newLocalClone(t)
+	r, err := git.PlainOpen(repos.work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("scratch"), head.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := GitStatiGet(context.Background(), nil, []string{repos.work}, StatiOpts{})
+	status, ok := s.NeedsNothingList[repos.work]
+	if !ok {
+		t.Fatalf("branch without upstream should not need sync: %#v", s)
+	}
+	for _, b := range status.Branches {
+		if b.Name == "scratch" && (b.Sync != SyncNoUpstream || b.Detail != "no upstream") {
+			t.Fatalf("unexpected scratch status: %#v", b)
+		}
+	}
+}